@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"github.com/clementd64/tachiql/plugins/thumbnail"
+)
+
+const usage = `usage: tachiql <command> [arguments]
+
+commands:
+  thumbnails gc    remove the thumbnails not referenced by a backup
+`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "thumbnails" || os.Args[2] != "gc" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := thumbnailsGC(os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, "tachiql:", err)
+		os.Exit(1)
+	}
+}
+
+func thumbnailsGC(args []string) error {
+	flags := flag.NewFlagSet("tachiql thumbnails gc", flag.ExitOnError)
+	source := flags.String("backup", "", "backup file, or directory holding the backups")
+	dir := flags.String("path", "", "thumbnail directory")
+	index := flags.String("index", "", "thumbnail cache index file")
+	localSource := flags.String("local-source", "", "directory of the Tachiyomi local source")
+	coverCache := flags.String("cover-cache", "", "copy of the Tachiyomi cover cache")
+	trash := flags.String("trash", "", "directory orphaned thumbnails are moved to instead of being removed")
+	grace := flags.Duration("grace-period", 7*24*time.Hour, "how long thumbnails stay in the trash")
+	dryRun := flags.Bool("dry-run", false, "only report the orphaned thumbnails")
+	flags.Parse(args)
+
+	if *source == "" || *dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	b, err := loadBackup(*source)
+	if err != nil {
+		return err
+	}
+
+	gc := thumbnail.GC{DryRun: *dryRun, GracePeriod: *grace}
+	if *trash != "" {
+		gc.Trash = thumbnail.Dir(*trash)
+	}
+
+	t := thumbnail.New(thumbnail.Config{
+		Path:        *dir,
+		Index:       *index,
+		LocalSource: *localSource,
+		CoverCache:  *coverCache,
+	})
+	report, err := t.CollectGarbage(b.Mangas, gc)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range report.Orphans {
+		fmt.Println(name)
+	}
+
+	action := "removed"
+	if *trash != "" {
+		action = "moved to the trash"
+	}
+	if *dryRun {
+		action = "would be " + action
+	}
+	fmt.Printf("%d orphaned thumbnails %s, %s\n", len(report.Orphans), action, formatSize(report.Size))
+	if *trash != "" {
+		fmt.Printf("%d thumbnails purged from the trash, %s\n", len(report.Purged), formatSize(report.PurgedSize))
+	}
+	return nil
+}
+
+func loadBackup(source string) (*backup.Backup, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return backup.LoadFromDirectory(source)
+	}
+	return backup.LoadBackup(source)
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -3,13 +3,16 @@ module github.com/clementd64/tachiql
 go 1.17
 
 require (
+	github.com/andybalholm/brotli v1.0.5
 	github.com/fsnotify/fsnotify v1.5.1
 	github.com/graphql-go/graphql v0.8.0
 	github.com/graphql-go/handler v0.2.3
+	golang.org/x/crypto v0.8.0
+	golang.org/x/image v0.7.0
 	google.golang.org/protobuf v1.27.1
 )
 
 require (
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
@@ -43,10 +43,18 @@ func LoadBackup(filename string) (*Backup, error) {
 }
 
 func LoadFromDirectory(dirname string) (*Backup, error) {
-	files, err := ioutil.ReadDir(dirname)
+	filename, err := Latest(dirname)
 	if err != nil {
 		return nil, err
 	}
+	return LoadBackup(filename)
+}
+
+func Latest(dirname string) (string, error) {
+	files, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		return "", err
+	}
 
 	filename := ""
 
@@ -55,7 +63,8 @@ func LoadFromDirectory(dirname string) (*Backup, error) {
 			continue
 		}
 
-		if !strings.HasSuffix(file.Name(), ".proto.gz") {
+		// skip hidden files, such as the temporary files of sync tools
+		if !strings.HasSuffix(file.Name(), ".proto.gz") || strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
 
@@ -65,8 +74,8 @@ func LoadFromDirectory(dirname string) (*Backup, error) {
 	}
 
 	if filename != "" {
-		return LoadBackup(path.Join(dirname, filename))
+		return path.Join(dirname, filename), nil
 	}
 
-	return nil, errors.New("no backup found")
+	return "", errors.New("no backup found")
 }
@@ -79,7 +79,7 @@ func (g *graphGenerator) genStructFields(t reflect.Type) graphql.Fields {
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		if name := getName(field); name != "" {
+		if name := FieldName(field); name != "" {
 			fields[name] = &graphql.Field{
 				Name: name,
 				Type: g.gen(field.Type),
@@ -90,7 +90,7 @@ func (g *graphGenerator) genStructFields(t reflect.Type) graphql.Fields {
 	return fields
 }
 
-func getName(field reflect.StructField) string {
+func FieldName(field reflect.StructField) string {
 	json, ok := field.Tag.Lookup("json")
 	if !ok {
 		return ""
@@ -110,7 +110,7 @@ func ToMap(obj interface{}) map[string]interface{} {
 
 	m := map[string]interface{}{}
 	for i := 0; i < v.NumField(); i++ {
-		if name := getName(v.Type().Field(i)); name != "" {
+		if name := FieldName(v.Type().Field(i)); name != "" {
 			m[name] = v.Field(i).Interface()
 		}
 	}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+type Event interface{}
+
+type RootChanged struct {
+	Old      interface{}
+	New      interface{}
+	Source   string
+	Duration time.Duration
+}
+
+type RootFailed struct {
+	Source string
+	Err    error
+}
+
+type PluginError struct {
+	Plugin string
+	Err    error
+}
+
+type WorkerStarted struct {
+	Plugin string
+}
+
+type WorkerStopped struct {
+	Plugin string
+	Err    error
+}
+
+// Bus dispatches events synchronously to every subscriber, in the goroutine
+// calling Publish. Subscribers must not block.
+type Bus struct {
+	mu          sync.RWMutex
+	next        int
+	subscribers []subscriber
+}
+
+type subscriber struct {
+	id int
+	fn func(Event)
+}
+
+func (b *Bus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subscribers = append(b.subscribers, subscriber{id, fn})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subscribers {
+			if s.id == id {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, s := range subscribers {
+		s.fn(event)
+	}
+}
+
+func PluginName(plugin interface{}) string {
+	t := reflect.TypeOf(plugin)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
@@ -2,16 +2,27 @@ package graph
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
 	"github.com/graphql-go/graphql"
 )
 
+type RootInfo struct {
+	Source   string
+	LoadedAt time.Time
+}
+
 type Graph struct {
-	Schema graphql.Schema
-	Types  map[string]*graphql.Object
-	Root   interface{}
+	Schema   graphql.Schema
+	Types    map[string]*graphql.Object
+	Root     interface{}
+	RootInfo RootInfo
+	Events   *Bus
 
+	version    uint64
 	plugins    Plugins
+	workers    *supervisor
 	context    context.Context
 	StopWorker context.CancelFunc
 }
@@ -27,25 +38,55 @@ func New(obj interface{}, plugins Plugins) (*Graph, error) {
 	t := &Graph{
 		Schema:     schema,
 		Types:      types,
+		Events:     &Bus{},
 		plugins:    plugins,
+		workers:    newSupervisor(plugins),
 		context:    ctx,
 		StopWorker: cancel,
 	}
 
-	t.plugins.Schema(t)
+	if err := t.plugins.Schema(t); err != nil {
+		cancel()
+		return nil, err
+	}
 	return t, nil
 }
 
 func (t *Graph) SetRoot(root interface{}) error {
+	return t.SetRootFrom(root, "")
+}
+
+func (t *Graph) SetRootFrom(root interface{}, source string) error {
+	start := time.Now()
 	if err := t.plugins.Root(t, root); err != nil {
+		t.Events.Publish(RootFailed{Source: source, Err: err})
 		return err
 	}
 
+	old := t.Root
 	t.Root = root
+	t.RootInfo = RootInfo{Source: source, LoadedAt: time.Now()}
+	t.Invalidate()
 	t.plugins.Clean()
+	t.Events.Publish(RootChanged{Old: old, New: root, Source: source, Duration: time.Since(start)})
 	return nil
 }
 
+// Invalidate marks the data served from the current root as changed, for
+// plugins updating it outside of SetRoot.
+func (t *Graph) Invalidate() {
+	atomic.AddUint64(&t.version, 1)
+}
+
+// Version is incremented every time the data served from the root changes.
+func (t *Graph) Version() uint64 {
+	return atomic.LoadUint64(&t.version)
+}
+
 func (t *Graph) StartWorker() error {
 	return t.plugins.Worker(t.context, t.StopWorker, t)
 }
+
+func (t *Graph) WorkerStatus() []WorkerStatus {
+	return t.workers.Status()
+}
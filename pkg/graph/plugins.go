@@ -9,6 +9,9 @@ import (
 )
 
 type Plugin struct {
+	Name    string
+	Restart RestartPolicy
+
 	Schema func(*Graph) error                  `plugin:""`
 	Root   func(*Graph, interface{}) error     `plugin:""`
 	Clean  func()                              `plugin:""`
@@ -19,9 +22,18 @@ func WrapPlugins(plugins []interface{}) (Plugins, error) {
 	p := Plugins{}
 	for _, plugin := range plugins {
 		wrapper := Plugin{}
+		if r, ok := plugin.(*restartable); ok {
+			plugin = r.plugin
+			wrapper.Restart = r.policy
+		}
+
+		wrapper.Name = PluginName(plugin)
 		if err := WrapPlugin(plugin, &wrapper); err != nil {
 			return nil, err
 		}
+		if _, ok := method(reflect.ValueOf(plugin), "Worker"); !ok {
+			wrapper.Worker = nil
+		}
 		p = append(p, wrapper)
 	}
 	return p, nil
@@ -41,6 +53,7 @@ func (p *Plugins) Schema(g *Graph) error {
 func (p *Plugins) Root(t *Graph, root interface{}) error {
 	for _, plugin := range *p {
 		if err := plugin.Root(t, root); err != nil {
+			t.Events.Publish(PluginError{Plugin: plugin.Name, Err: err})
 			return err
 		}
 	}
@@ -55,16 +68,27 @@ func (p *Plugins) Clean() {
 
 func (p *Plugins) Worker(ctx context.Context, cancel context.CancelFunc, t *Graph) error {
 	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
 	var err error
+	worker := 0
 	for _, plugin := range *p {
+		if plugin.Worker == nil {
+			continue
+		}
+
 		wg.Add(1)
-		go func(plugin Plugin) {
+		go func(worker int, plugin Plugin) {
 			defer wg.Done()
-			if e := plugin.Worker(ctx, t); e != nil {
+			if e := t.workers.run(ctx, t, worker, plugin); e != nil {
+				mu.Lock()
 				err = e
-				cancel()
+				mu.Unlock()
+				if plugin.Restart.critical() {
+					cancel()
+				}
 			}
-		}(plugin)
+		}(worker, plugin)
+		worker++
 	}
 	wg.Wait()
 	return err
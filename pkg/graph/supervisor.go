@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Restart int
+
+const (
+	RestartNever Restart = iota
+	RestartOnFailure
+	RestartAlways
+)
+
+type RestartPolicy struct {
+	Restart Restart
+	// MaxRestarts is the number of restarts allowed before giving up, 0 means unlimited
+	MaxRestarts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// Critical workers stop every other worker when they give up. Workers
+	// that are never restarted are always critical.
+	Critical bool
+}
+
+func (p RestartPolicy) critical() bool {
+	return p.Critical || p.Restart == RestartNever
+}
+
+func (p RestartPolicy) shouldRestart(err error, restarts int) bool {
+	if p.MaxRestarts > 0 && restarts >= p.MaxRestarts {
+		return false
+	}
+
+	switch p.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+func (p RestartPolicy) backoff() (time.Duration, time.Duration) {
+	backoff, max := p.Backoff, p.MaxBackoff
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	if max == 0 {
+		max = time.Minute
+	}
+	if max < backoff {
+		max = backoff
+	}
+	return backoff, max
+}
+
+type restartable struct {
+	plugin interface{}
+	policy RestartPolicy
+}
+
+func WithRestart(plugin interface{}, policy RestartPolicy) interface{} {
+	return &restartable{plugin, policy}
+}
+
+type WorkerState int
+
+const (
+	StatePending WorkerState = iota
+	StateRunning
+	StateRestarting
+	StateStopped
+	StateFailed
+)
+
+func (s WorkerState) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateRunning:
+		return "running"
+	case StateRestarting:
+		return "restarting"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type WorkerStatus struct {
+	Plugin      string
+	State       WorkerState
+	Restarts    int
+	StartedAt   time.Time
+	LastError   error
+	LastErrorAt time.Time
+}
+
+type supervisor struct {
+	mu     sync.RWMutex
+	status []WorkerStatus
+}
+
+func newSupervisor(plugins Plugins) *supervisor {
+	s := &supervisor{}
+	for _, plugin := range plugins {
+		if plugin.Worker != nil {
+			s.status = append(s.status, WorkerStatus{Plugin: plugin.Name})
+		}
+	}
+	return s
+}
+
+func (s *supervisor) update(worker int, fn func(*WorkerStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.status[worker])
+}
+
+func (s *supervisor) Status() []WorkerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]WorkerStatus(nil), s.status...)
+}
+
+func (s *supervisor) run(ctx context.Context, t *Graph, worker int, plugin Plugin) error {
+	backoff, max := plugin.Restart.backoff()
+
+	for restarts := 0; ; restarts++ {
+		started := time.Now()
+		s.update(worker, func(status *WorkerStatus) {
+			status.State = StateRunning
+			status.StartedAt = started
+			status.Restarts = restarts
+		})
+		t.Events.Publish(WorkerStarted{Plugin: plugin.Name})
+
+		err := runWorker(ctx, t, plugin)
+
+		t.Events.Publish(WorkerStopped{Plugin: plugin.Name, Err: err})
+		if err != nil {
+			t.Events.Publish(PluginError{Plugin: plugin.Name, Err: err})
+		}
+
+		if ctx.Err() != nil || !plugin.Restart.shouldRestart(err, restarts) {
+			s.update(worker, func(status *WorkerStatus) {
+				status.State = StateStopped
+				if err != nil {
+					status.State = StateFailed
+					status.LastError = err
+					status.LastErrorAt = time.Now()
+				}
+			})
+			return err
+		}
+
+		if time.Since(started) > max {
+			backoff, _ = plugin.Restart.backoff()
+		}
+
+		s.update(worker, func(status *WorkerStatus) {
+			status.State = StateRestarting
+			if err != nil {
+				status.LastError = err
+				status.LastErrorAt = time.Now()
+			}
+		})
+
+		select {
+		case <-ctx.Done():
+			s.update(worker, func(status *WorkerStatus) {
+				status.State = StateStopped
+			})
+			return nil
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > max {
+			backoff = max
+		}
+	}
+}
+
+func runWorker(ctx context.Context, t *Graph, plugin Plugin) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in %s worker: %v", plugin.Name, r)
+		}
+	}()
+	return plugin.Worker(ctx, t)
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/clementd64/tachiql/plugins/server"
+	"github.com/clementd64/tachiql/plugins/thumbnail"
+)
+
+type Metrics struct {
+	Server  *server.Server
+	Path    string
+	Buckets []float64
+	// MaxOperations is the number of distinct operation names tracked, 50 by
+	// default. Operation names come from the clients, later ones are counted
+	// as "other".
+	MaxOperations int
+
+	mu                 sync.Mutex
+	requests           map[string]*histogram
+	resolverErrors     map[string]float64
+	reloads            float64
+	reloadFailures     float64
+	reloadDuration     *histogram
+	thumbnailDownloads float64
+	thumbnailFailures  float64
+	thumbnailBytes     float64
+	thumbnailCollected float64
+}
+
+// otherOperation is the label of the operations past MaxOperations.
+const otherOperation = "other"
+
+func (m *Metrics) Schema(g *graph.Graph) error {
+	if m.Server == nil {
+		return errors.New("metrics: Server is required")
+	}
+
+	if m.Path == "" {
+		m.Path = "/metrics"
+	}
+
+	if m.Buckets == nil {
+		m.Buckets = DefaultBuckets
+	}
+
+	if m.MaxOperations <= 0 {
+		m.MaxOperations = 50
+	}
+
+	m.requests = map[string]*histogram{}
+	m.resolverErrors = map[string]float64{}
+	m.reloadDuration = newHistogram(m.Buckets)
+
+	g.Events.Subscribe(m.record)
+	m.Server.Handle(m.Path, m.handler(g))
+	return nil
+}
+
+func (m *Metrics) record(event graph.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch e := event.(type) {
+	case server.Request:
+		operation := e.Operation
+		h, ok := m.requests[operation]
+		if !ok && len(m.requests) >= m.MaxOperations {
+			operation = otherOperation
+			h, ok = m.requests[operation]
+		}
+		if !ok {
+			h = newHistogram(m.Buckets)
+			m.requests[operation] = h
+		}
+		h.observe(e.Duration.Seconds())
+		if e.Errors > 0 {
+			m.resolverErrors[operation] += float64(e.Errors)
+		}
+	case graph.RootChanged:
+		m.reloads++
+		m.reloadDuration.observe(e.Duration.Seconds())
+	case graph.RootFailed:
+		m.reloadFailures++
+	case thumbnail.Downloaded:
+		m.thumbnailDownloads++
+		m.thumbnailBytes += float64(e.Size)
+	case thumbnail.Failed:
+		m.thumbnailFailures++
+	case thumbnail.Collected:
+		m.thumbnailCollected += float64(e.Report.Size + e.Report.PurgedSize)
+	}
+}
+
+func (m *Metrics) handler(g *graph.Graph) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		m.write(buf, g)
+
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(rw)
+	})
+}
+
+func (m *Metrics) write(buf *bytes.Buffer, g *graph.Graph) {
+	w := &writer{w: buf}
+
+	m.mu.Lock()
+	requests := map[string]float64{}
+	for operation, h := range m.requests {
+		requests[operation] = float64(h.count)
+	}
+	w.counterVec("tachiql_graphql_requests_total", "Number of GraphQL requests.", "operation", requests)
+	w.histogramVec("tachiql_graphql_request_duration_seconds", "GraphQL request latency.", "operation", m.requests)
+	w.counterVec("tachiql_graphql_resolver_errors_total", "Number of errors returned by GraphQL resolvers.", "operation", m.resolverErrors)
+	w.counter("tachiql_backup_reloads_total", "Number of successful backup reloads.", m.reloads)
+	w.counter("tachiql_backup_reload_failures_total", "Number of failed backup reloads.", m.reloadFailures)
+	w.histogram("tachiql_backup_reload_duration_seconds", "Time spent applying a backup.", m.reloadDuration)
+	w.counter("tachiql_thumbnail_downloads_total", "Number of downloaded thumbnails.", m.thumbnailDownloads)
+	w.counter("tachiql_thumbnail_download_failures_total", "Number of failed thumbnail downloads.", m.thumbnailFailures)
+	w.counter("tachiql_thumbnail_downloaded_bytes_total", "Number of bytes of downloaded thumbnails.", m.thumbnailBytes)
+	w.counter("tachiql_thumbnail_collected_bytes_total", "Number of bytes of orphaned thumbnails collected.", m.thumbnailCollected)
+	m.mu.Unlock()
+
+	mangas, chapters, unread := librarySize(g.Root)
+	w.gauge("tachiql_library_mangas", "Number of mangas in the current backup.", mangas)
+	w.gauge("tachiql_library_chapters", "Number of chapters in the current backup.", chapters)
+	w.gauge("tachiql_library_unread_chapters", "Number of unread chapters in the current backup.", unread)
+}
+
+func librarySize(root interface{}) (mangas, chapters, unread float64) {
+	b, ok := root.(*backup.Backup)
+	if !ok {
+		return
+	}
+
+	for _, manga := range b.Mangas {
+		mangas++
+		for _, chapter := range manga.Chapters {
+			chapters++
+			if !chapter.GetRead() {
+				unread++
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/clementd64/tachiql/plugins/server"
+	"google.golang.org/protobuf/proto"
+)
+
+func scrape(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	res, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestScrape(t *testing.T) {
+	s := &server.Server{}
+	m := &Metrics{Server: s, MaxOperations: 2}
+	plugins, err := graph.WrapPlugins([]interface{}{m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := graph.New(&backup.Backup{}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &backup.Backup{Mangas: []*backup.Manga{{
+		Chapters: []*backup.Chapter{{Read: proto.Bool(true)}, {}},
+	}}}
+	if err := g.SetRoot(b); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		g.Events.Publish(server.Request{Operation: "Query" + strconv.Itoa(i), Duration: time.Millisecond})
+	}
+	g.Events.Publish(server.Request{Operation: "Query0", Duration: time.Millisecond, Errors: 1})
+
+	srv := httptest.NewServer(s.ServeMux)
+	defer srv.Close()
+	body := scrape(t, srv)
+
+	for _, line := range []string{
+		`tachiql_graphql_requests_total{operation="Query0"} 2`,
+		`tachiql_graphql_requests_total{operation="Query1"} 1`,
+		`tachiql_graphql_requests_total{operation="other"} 8`,
+		`tachiql_graphql_resolver_errors_total{operation="Query0"} 1`,
+		`tachiql_backup_reloads_total 1`,
+		`tachiql_library_mangas 1`,
+		`tachiql_library_chapters 2`,
+		`tachiql_library_unread_chapters 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `operation="Query2"`) {
+		t.Errorf("operations past MaxOperations are not counted as other:\n%s", body)
+	}
+}
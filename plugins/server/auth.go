@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/graphql-go/graphql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+type Principal struct {
+	Name string
+	// Hide lists the GraphQL types the principal is not allowed to read
+	Hide []string
+}
+
+func (p *Principal) hides(typename string) bool {
+	for _, hidden := range p.Hide {
+		if hidden == typename {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator returns a nil principal and a nil error when the request
+// holds no credentials it understands.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(r *http.Request) (*Principal, error) {
+	for _, auth := range a {
+		if principal, err := auth.Authenticate(r); principal != nil || err != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
+
+func (a Authenticators) challenge() string {
+	challenges := []string{}
+	for _, auth := range a {
+		if c, ok := auth.(challenger); ok {
+			challenges = append(challenges, c.challenge())
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+type challenger interface {
+	challenge() string
+}
+
+// Tokens maps static bearer tokens to their principal.
+type Tokens map[string]*Principal
+
+func (t Tokens) Authenticate(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, nil
+	}
+
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	var principal *Principal
+	for t, p := range t {
+		if subtle.ConstantTimeCompare([]byte(t), token) == 1 {
+			principal = p
+		}
+	}
+
+	if principal == nil {
+		return nil, ErrUnauthorized
+	}
+	return principal, nil
+}
+
+func (t Tokens) challenge() string {
+	return `Bearer realm="tachiql"`
+}
+
+type BasicUser struct {
+	// Hash is the bcrypt hash of the user password
+	Hash      string
+	Principal *Principal
+}
+
+// dummyHash is compared against the password of unknown users.
+const dummyHash = "$2a$10$lcNulgRyGj/XK2kEKq2uGOStUBuBZragk7dvkkqc0bdnV4OH3u78C"
+
+// Basic maps HTTP Basic usernames to their password hash and principal.
+type Basic map[string]BasicUser
+
+func (b Basic) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	user, known := b[username]
+	hash := user.Hash
+	if !known {
+		// unknown users still pay for a comparison, so the response time does
+		// not reveal which usernames exist
+		hash = dummyHash
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !known {
+		return nil, ErrUnauthorized
+	}
+
+	if user.Principal == nil {
+		return &Principal{Name: username}, nil
+	}
+	return user.Principal, nil
+}
+
+func (b Basic) challenge() string {
+	return `Basic realm="tachiql", charset="UTF-8"`
+}
+
+// ProxyHeader trusts the user name set by a reverse proxy, as long as the
+// request comes from one of the Trusted addresses.
+type ProxyHeader struct {
+	Header string
+	// Trusted holds the IP addresses or CIDR of the reverse proxies
+	Trusted []string
+	Users   map[string]*Principal
+	// Default is used for authenticated users missing from Users, they are rejected when nil
+	Default *Principal
+}
+
+func (p *ProxyHeader) Authenticate(r *http.Request) (*Principal, error) {
+	header := p.Header
+	if header == "" {
+		header = "X-Forwarded-User"
+	}
+
+	name := r.Header.Get(header)
+	if name == "" || !p.trusted(r.RemoteAddr) {
+		return nil, nil
+	}
+
+	if principal, ok := p.Users[name]; ok {
+		return principal, nil
+	}
+
+	if p.Default != nil {
+		return &Principal{Name: name, Hide: p.Default.Hide}, nil
+	}
+	return nil, ErrUnauthorized
+}
+
+func (p *ProxyHeader) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, trusted := range p.Trusted {
+		if _, network, err := net.ParseCIDR(trusted); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(trusted)) {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// authenticate rejects requests without valid credentials, unless Anonymous
+// is set in which case they are served with the anonymous principal.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.Auth == nil && s.Anonymous == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal *Principal
+		var err error
+		if s.Auth != nil {
+			principal, err = s.Auth.Authenticate(r)
+		}
+
+		if err == nil && principal == nil {
+			if s.Anonymous == nil {
+				err = ErrUnauthorized
+			}
+			principal = s.Anonymous
+		}
+
+		if err != nil {
+			if c, ok := s.Auth.(challenger); ok {
+				w.Header().Set("WWW-Authenticate", c.challenge())
+			}
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// restrictTypes guards every field returning an object so that principals
+// hiding its type get an error instead of the value.
+func restrictTypes(t *graph.Graph) {
+	for _, object := range t.Types {
+		for _, field := range object.Fields() {
+			typename := namedType(field.Type)
+			if _, ok := t.Types[typename]; !ok {
+				continue
+			}
+
+			resolve := field.Resolve
+			if resolve == nil {
+				resolve = graphql.DefaultResolveFn
+			}
+
+			field.Resolve = func(p graphql.ResolveParams) (interface{}, error) {
+				if principal := PrincipalFromContext(p.Context); principal != nil && principal.hides(typename) {
+					return nil, fmt.Errorf("access to %s is denied", typename)
+				}
+				return resolve(p)
+			}
+		}
+	}
+}
+
+func namedType(t graphql.Type) string {
+	switch t := t.(type) {
+	case *graphql.List:
+		return namedType(t.OfType)
+	case *graphql.NonNull:
+		return namedType(t.OfType)
+	default:
+		return t.Name()
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": err.Error()}},
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed explorer
+var explorerFS embed.FS
+
+var explorerTemplate = template.Must(template.ParseFS(explorerFS, "explorer/index.html"))
+
+type explorerExample struct {
+	Name string
+}
+
+type explorerConfig struct {
+	Endpoint string            `json:"endpoint"`
+	Examples map[string]string `json:"examples"`
+}
+
+func explorerExamples() (map[string]string, error) {
+	examples := map[string]string{}
+	files, err := fs.ReadDir(explorerFS, "explorer/examples")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		query, err := fs.ReadFile(explorerFS, "explorer/examples/"+file.Name())
+		if err != nil {
+			return nil, err
+		}
+		examples[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = string(query)
+	}
+	return examples, nil
+}
+
+func (s *Server) explorerHandler() http.Handler {
+	examples, err := explorerExamples()
+	if err != nil {
+		panic(err)
+	}
+
+	names := []explorerExample{}
+	for name := range examples {
+		names = append(names, explorerExample{name})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Name < names[j].Name })
+
+	index := &bytes.Buffer{}
+	err = explorerTemplate.Execute(index, map[string]interface{}{
+		"Examples": names,
+		"Config":   explorerConfig{Endpoint: s.Path, Examples: examples},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	assets, err := fs.Sub(explorerFS, "explorer")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix(s.ExplorerPath, http.FileServer(http.FS(assets)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != s.ExplorerPath && r.URL.Path != s.ExplorerPath+"index.html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index.Bytes())
+	})
+}
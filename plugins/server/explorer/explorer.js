@@ -0,0 +1,217 @@
+(function () {
+  "use strict";
+
+  var config = JSON.parse(document.getElementById("config").textContent);
+  var query = document.getElementById("query");
+  var variables = document.getElementById("variables");
+  var result = document.getElementById("result");
+  var status = document.getElementById("status");
+  var examples = document.getElementById("examples");
+  var docs = document.getElementById("docs");
+  var docsPath = document.getElementById("docs-path");
+  var docsContent = document.getElementById("docs-content");
+
+  var storageKey = "tachiql:" + config.endpoint;
+  var schema = null;
+  var history = [];
+
+  function load() {
+    try {
+      var saved = JSON.parse(localStorage.getItem(storageKey) || "{}");
+      query.value = saved.query || config.examples.library || "";
+      variables.value = saved.variables || "";
+    } catch (e) {
+      query.value = config.examples.library || "";
+    }
+  }
+
+  function save() {
+    try {
+      localStorage.setItem(storageKey, JSON.stringify({
+        query: query.value,
+        variables: variables.value,
+      }));
+    } catch (e) {
+      // storage may be disabled, the editor still works without it
+    }
+  }
+
+  function request(body) {
+    return fetch(config.endpoint, {
+      method: "POST",
+      credentials: "same-origin",
+      headers: {
+        "Accept": "application/json",
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(body),
+    }).then(function (res) {
+      return res.json();
+    });
+  }
+
+  function run() {
+    var vars = {};
+    if (variables.value.trim() !== "") {
+      try {
+        vars = JSON.parse(variables.value);
+      } catch (e) {
+        result.textContent = "Invalid variables: " + e.message;
+        return;
+      }
+    }
+
+    save();
+    status.textContent = "Running…";
+    var start = performance.now();
+    request({ query: query.value, variables: vars }).then(function (data) {
+      status.textContent = Math.round(performance.now() - start) + " ms";
+      result.textContent = JSON.stringify(data, null, 2);
+    }).catch(function (e) {
+      status.textContent = "";
+      result.textContent = String(e);
+    });
+  }
+
+  function prettify() {
+    var depth = 0;
+    var out = "";
+    var lines = query.value.split("\n");
+    for (var i = 0; i < lines.length; i++) {
+      var line = lines[i].trim();
+      if (line === "") {
+        continue;
+      }
+      if (line[0] === "}") {
+        depth--;
+      }
+      out += "  ".repeat(Math.max(depth, 0)) + line + "\n";
+      depth += (line.match(/{/g) || []).length - (line.match(/}/g) || []).length;
+      if (line[0] === "}") {
+        depth++;
+      }
+    }
+    query.value = out;
+    save();
+  }
+
+  var introspection = "query IntrospectionQuery { __schema { queryType { name } types { " +
+    "name kind description fields { name description type { ...TypeRef } } } } } " +
+    "fragment TypeRef on __Type { kind name ofType { kind name ofType { kind name ofType { kind name } } } }";
+
+  function typeName(type) {
+    if (type.kind === "NON_NULL") {
+      return typeName(type.ofType) + "!";
+    }
+    if (type.kind === "LIST") {
+      return "[" + typeName(type.ofType) + "]";
+    }
+    return type.name;
+  }
+
+  function namedType(type) {
+    return type.ofType ? namedType(type.ofType) : type.name;
+  }
+
+  function link(name) {
+    var a = document.createElement("a");
+    a.textContent = name;
+    a.addEventListener("click", function () {
+      history.push(name);
+      renderType(name);
+    });
+    return a;
+  }
+
+  function renderType(name) {
+    var type = schema.types.filter(function (t) { return t.name === name; })[0];
+    docsPath.textContent = "";
+    if (history.length > 1) {
+      var back = document.createElement("a");
+      back.textContent = "← " + history[history.length - 2];
+      back.addEventListener("click", function () {
+        history.pop();
+        renderType(history[history.length - 1]);
+      });
+      docsPath.appendChild(back);
+    }
+
+    docsContent.textContent = "";
+    var title = document.createElement("h2");
+    title.textContent = name;
+    docsContent.appendChild(title);
+
+    if (!type) {
+      return;
+    }
+
+    if (type.description) {
+      var description = document.createElement("p");
+      description.className = "description";
+      description.textContent = type.description;
+      docsContent.appendChild(description);
+    }
+
+    var list = document.createElement("ul");
+    (type.fields || []).forEach(function (field) {
+      var item = document.createElement("li");
+      item.appendChild(document.createTextNode(field.name + ": "));
+      var ref = link(namedType(field.type));
+      ref.textContent = typeName(field.type);
+      item.appendChild(ref);
+      list.appendChild(item);
+    });
+    docsContent.appendChild(list);
+  }
+
+  function toggleDocs() {
+    docs.hidden = !docs.hidden;
+    if (docs.hidden || schema) {
+      return;
+    }
+
+    docsContent.textContent = "Loading…";
+    request({ query: introspection }).then(function (data) {
+      if (data.errors) {
+        docsContent.textContent = data.errors[0].message;
+        return;
+      }
+      schema = data.data.__schema;
+      history = [schema.queryType.name];
+      renderType(schema.queryType.name);
+    });
+  }
+
+  query.addEventListener("keydown", function (e) {
+    if (e.key === "Tab") {
+      e.preventDefault();
+      var start = query.selectionStart;
+      query.value = query.value.slice(0, start) + "  " + query.value.slice(query.selectionEnd);
+      query.selectionStart = query.selectionEnd = start + 2;
+    }
+  });
+
+  document.addEventListener("keydown", function (e) {
+    if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
+      e.preventDefault();
+      run();
+    }
+  });
+
+  examples.addEventListener("change", function () {
+    if (examples.value !== "") {
+      query.value = config.examples[examples.value];
+      variables.value = "";
+      examples.value = "";
+      save();
+    }
+  });
+
+  query.addEventListener("input", save);
+  variables.addEventListener("input", save);
+  document.getElementById("run").addEventListener("click", run);
+  document.getElementById("prettify").addEventListener("click", prettify);
+  document.getElementById("toggle-docs").addEventListener("click", toggleDocs);
+
+  load();
+})();
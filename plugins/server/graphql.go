@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/handler"
+)
+
+type Request struct {
+	Operation string
+	Duration  time.Duration
+	Errors    int
+}
+
+type requestKey struct{}
+
+func (s *Server) graphqlHandler(t *graph.Graph) http.Handler {
+	h := handler.New(&handler.Config{
+		Schema: &t.Schema,
+		RootObjectFn: func(ctx context.Context, r *http.Request) map[string]interface{} {
+			return graph.ToMap(t.Root)
+		},
+		ResultCallbackFn: func(ctx context.Context, params *graphql.Params, result *graphql.Result, _ []byte) {
+			if req, ok := ctx.Value(requestKey{}).(*Request); ok {
+				req.Operation = operationName(params)
+				req.Errors = len(result.Errors)
+			}
+		},
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &Request{}
+		start := time.Now()
+		h.ContextHandler(context.WithValue(r.Context(), requestKey{}, req), w, r)
+		req.Duration = time.Since(start)
+		t.Events.Publish(*req)
+	})
+}
+
+// readOptions parses the GraphQL request while leaving the body readable by
+// the next handler.
+func readOptions(r *http.Request) (*handler.RequestOptions, error) {
+	if r.Body == nil {
+		return handler.NewRequestOptions(r), nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	opts := handler.NewRequestOptions(r)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return opts, nil
+}
+
+func operationName(params *graphql.Params) string {
+	if params.OperationName != "" {
+		return params.OperationName
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: params.RequestString})
+	if err != nil {
+		return ""
+	}
+
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && op.Name != nil {
+			return op.Name.Value
+		}
+	}
+	return ""
+}
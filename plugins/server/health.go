@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/graph"
+)
+
+type pluginErrors struct {
+	mu     sync.RWMutex
+	errors map[string]pluginError
+}
+
+type pluginError struct {
+	err error
+	at  time.Time
+}
+
+func (p *pluginErrors) record(event graph.Event) {
+	if e, ok := event.(graph.PluginError); ok {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.errors == nil {
+			p.errors = map[string]pluginError{}
+		}
+		p.errors[e.Plugin] = pluginError{e.Err, time.Now()}
+	}
+}
+
+func (p *pluginErrors) get(plugin string) (pluginError, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e, ok := p.errors[plugin]
+	return e, ok
+}
+
+type healthReport struct {
+	Ready   bool           `json:"ready"`
+	Backup  *backupReport  `json:"backup"`
+	Plugins []pluginReport `json:"plugins"`
+}
+
+type backupReport struct {
+	Source   string    `json:"source,omitempty"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+type pluginReport struct {
+	Name        string     `json:"name"`
+	State       string     `json:"state,omitempty"`
+	Restarts    int        `json:"restarts,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+func (s *Server) health(t *graph.Graph) healthReport {
+	report := healthReport{Ready: t.Root != nil}
+
+	if t.Root != nil {
+		report.Backup = &backupReport{
+			Source:   t.RootInfo.Source,
+			LoadedAt: t.RootInfo.LoadedAt,
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, status := range t.WorkerStatus() {
+		if status.State != graph.StateRunning {
+			report.Ready = false
+		}
+
+		plugin := pluginReport{
+			Name:     status.Plugin,
+			State:    status.State.String(),
+			Restarts: status.Restarts,
+		}
+		if e, ok := s.errors.get(status.Plugin); ok {
+			plugin.LastError = e.err.Error()
+			plugin.LastErrorAt = &e.at
+		}
+		report.Plugins = append(report.Plugins, plugin)
+		seen[status.Plugin] = true
+	}
+
+	s.errors.mu.RLock()
+	defer s.errors.mu.RUnlock()
+	names := []string{}
+	for name := range s.errors.errors {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := s.errors.errors[name]
+		report.Plugins = append(report.Plugins, pluginReport{
+			Name:        name,
+			LastError:   e.err.Error(),
+			LastErrorAt: &e.at,
+		})
+	}
+
+	return report
+}
+
+func (s *Server) healthHandler(t *graph.Graph, readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := s.health(t)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if readiness && !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
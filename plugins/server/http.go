@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/clementd64/tachiql/pkg/graph"
+)
+
+type CORS struct {
+	// AllowedOrigins holds the allowed origins, "*" allows any origin and can
+	// not be combined with AllowCredentials
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value of the origin, a
+// literal "*" when only the wildcard matches.
+func (c *CORS) allowOrigin(origin string) string {
+	wildcard := false
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+		wildcard = wildcard || allowed == "*"
+	}
+	if wildcard {
+		return "*"
+	}
+	return ""
+}
+
+func (c *CORS) validate() error {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" && c.AllowCredentials {
+			return errors.New("cors: the \"*\" origin can not be used with AllowCredentials")
+		}
+	}
+	return nil
+}
+
+func (s *Server) cors(next http.Handler) http.Handler {
+	if s.CORS == nil {
+		return next
+	}
+
+	headers := s.CORS.AllowedHeaders
+	if headers == nil {
+		headers = []string{"Authorization", "Content-Type"}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		allowed := ""
+		if origin != "" {
+			allowed = s.CORS.allowOrigin(origin)
+		}
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if s.CORS.AllowCredentials && allowed != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			if s.CORS.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(s.CORS.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cache answers GET queries with an ETag derived from the backup version, so
+// clients can revalidate until the backup changes.
+func (s *Server) cache(t *graph.Graph, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.RawQuery == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal := ""
+		if p := PrincipalFromContext(r.Context()); p != nil {
+			principal = p.Name
+		}
+
+		hash := sha256.Sum256([]byte(principal + "\x00" + r.URL.RawQuery))
+		etag := `W/"` + strconv.FormatUint(t.Version(), 10) + "-" + base64.RawURLEncoding.EncodeToString(hash[:12]) + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", s.CacheControl)
+		w.Header().Add("Vary", "Authorization")
+
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func etagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+const compressMinSize = 1024
+
+func (s *Server) compress(next http.Handler) http.Handler {
+	if !s.Compression {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func acceptEncoding(header string) string {
+	gzip := false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(fields) > 1 && strings.TrimSpace(fields[1]) == "q=0" {
+			continue
+		}
+
+		switch name {
+		case "br":
+			return "br"
+		case "gzip":
+			gzip = true
+		}
+	}
+
+	if gzip {
+		return "gzip"
+	}
+	return ""
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	writer   io.WriteCloser
+	decided  bool
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	c.status = status
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide(0)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.decided {
+		c.decide(len(p))
+	}
+
+	if c.writer != nil {
+		return c.writer.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// decide compresses the response if the first write is large enough, the
+// GraphQL handler writes its whole body at once.
+func (c *compressWriter) decide(size int) {
+	c.decided = true
+	header := c.ResponseWriter.Header()
+
+	if size >= compressMinSize && header.Get("Content-Encoding") == "" && c.status != http.StatusNotModified {
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+
+		switch c.encoding {
+		case "br":
+			c.writer = brotli.NewWriter(c.ResponseWriter)
+		case "gzip":
+			c.writer = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+}
+
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		c.decide(0)
+	}
+
+	if c.writer != nil {
+		return c.writer.Close()
+	}
+	return nil
+}
+
+func (c *compressWriter) Flush() {
+	if c.writer != nil {
+		if f, ok := c.writer.(interface{ Flush() error }); ok {
+			f.Flush()
+		}
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := c.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
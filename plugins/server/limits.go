@@ -0,0 +1,352 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+type Limits struct {
+	MaxDepth int
+	MaxCost  int
+	// DefaultListSize is the size of lists without a first argument that are
+	// empty or missing from the current root
+	DefaultListSize int
+	// Rate is the cost each client is allowed per second, up to Burst
+	Rate  float64
+	Burst float64
+
+	mu       sync.Mutex
+	version  uint64
+	sizes    map[string]int
+	buckets  map[string]*bucket
+	lastTrim time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (s *Server) limit(t *graph.Graph, next http.Handler) http.Handler {
+	if s.Limits == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts, err := readOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: opts.Query})
+		if err != nil {
+			// let the handler report syntax errors
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		depth, cost := s.Limits.analyze(t, doc, opts.OperationName, opts.Variables)
+		if s.Limits.MaxDepth > 0 && depth > s.Limits.MaxDepth {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("query depth %d exceeds the maximum depth of %d", depth, s.Limits.MaxDepth))
+			return
+		}
+		if s.Limits.MaxCost > 0 && cost > s.Limits.MaxCost {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("query cost %d exceeds the maximum cost of %d", cost, s.Limits.MaxCost))
+			return
+		}
+
+		if wait := s.Limits.take(client(r), float64(cost)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func client(r *http.Request) string {
+	if principal := PrincipalFromContext(r.Context()); principal != nil && principal.Name != "" {
+		return "principal:" + principal.Name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// take removes cost from the client bucket, and returns how long the client
+// has to wait when the bucket holds too few tokens.
+func (l *Limits) take(client string, cost float64) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	burst := l.Burst
+	if burst < l.Rate {
+		burst = l.Rate
+	}
+	if cost > burst {
+		cost = burst
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	l.trim(now, burst)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < cost {
+		return time.Duration((cost - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens -= cost
+	return 0
+}
+
+// trim forgets the clients whose bucket is full again.
+func (l *Limits) trim(now time.Time, burst float64) {
+	if now.Sub(l.lastTrim) < time.Minute {
+		return
+	}
+	l.lastTrim = now
+
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+type analysis struct {
+	limits    *Limits
+	sizes     map[string]int
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	visiting  map[string]bool
+}
+
+func (l *Limits) analyze(t *graph.Graph, doc *ast.Document, operationName string, variables map[string]interface{}) (int, int) {
+	a := &analysis{
+		limits:    l,
+		sizes:     l.listSizes(t),
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		visiting:  map[string]bool{},
+	}
+
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operation == nil || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+
+	if operation == nil {
+		return 0, 0
+	}
+	return a.selections(t.Schema.QueryType(), operation.SelectionSet)
+}
+
+func (a *analysis) selections(parent *graphql.Object, set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	depth, cost := 0, 0
+	for _, selection := range set.Selections {
+		d, c := 0, 0
+		switch selection := selection.(type) {
+		case *ast.Field:
+			// introspection is bounded by the schema, and the explorer
+			// queries it deeper than most limits
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			d, c = a.field(parent, selection)
+		case *ast.InlineFragment:
+			d, c = a.selections(a.fragmentType(parent, selection.TypeCondition), selection.SelectionSet)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			if fragment, ok := a.fragments[name]; ok && !a.visiting[name] {
+				a.visiting[name] = true
+				d, c = a.selections(a.fragmentType(parent, fragment.TypeCondition), fragment.SelectionSet)
+				a.visiting[name] = false
+			}
+		}
+
+		if d > depth {
+			depth = d
+		}
+		cost += c
+	}
+	return depth, cost
+}
+
+func (a *analysis) field(parent *graphql.Object, field *ast.Field) (int, int) {
+	var def *graphql.FieldDefinition
+	if parent != nil {
+		def = parent.Fields()[field.Name.Value]
+	}
+
+	var child *graphql.Object
+	list := false
+	if def != nil {
+		child, list = unwrapType(def.Type)
+	}
+
+	depth, cost := a.selections(child, field.SelectionSet)
+	if list && field.SelectionSet != nil {
+		cost *= a.listSize(parent, field)
+	}
+	return depth + 1, cost + 1
+}
+
+func (a *analysis) fragmentType(parent *graphql.Object, condition *ast.Named) *graphql.Object {
+	if condition == nil || parent == nil || condition.Name.Value == parent.Name() {
+		return parent
+	}
+	return nil
+}
+
+func (a *analysis) listSize(parent *graphql.Object, field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		switch arg.Name.Value {
+		case "first", "last", "limit":
+			if size, ok := a.intValue(arg.Value); ok {
+				return size
+			}
+		}
+	}
+
+	if size, ok := a.sizes[parent.Name()+"."+field.Name.Value]; ok && size > 0 {
+		return size
+	}
+
+	if a.limits.DefaultListSize > 0 {
+		return a.limits.DefaultListSize
+	}
+	return 1
+}
+
+func (a *analysis) intValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		i, err := strconv.Atoi(value.Value)
+		return i, err == nil
+	case *ast.Variable:
+		switch v := a.variables[value.Name.Value].(type) {
+		case float64:
+			return int(v), true
+		case int:
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func unwrapType(t graphql.Type) (*graphql.Object, bool) {
+	switch t := t.(type) {
+	case *graphql.List:
+		object, _ := unwrapType(t.OfType)
+		return object, true
+	case *graphql.NonNull:
+		return unwrapType(t.OfType)
+	case *graphql.Object:
+		return t, false
+	default:
+		return nil, false
+	}
+}
+
+// listSizes estimates the length of every list field from the current root,
+// using the average length among the objects holding it.
+func (l *Limits) listSizes(t *graph.Graph) map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sizes != nil && l.version == t.Version() {
+		return l.sizes
+	}
+
+	totals := map[string][2]int{}
+	if t.Root != nil {
+		collectSizes(reflect.ValueOf(t.Root), totals)
+	}
+
+	l.sizes = map[string]int{}
+	for key, total := range totals {
+		if total[1] > 0 {
+			l.sizes[key] = int(math.Ceil(float64(total[0]) / float64(total[1])))
+		}
+	}
+	l.version = t.Version()
+	return l.sizes
+}
+
+func collectSizes(v reflect.Value, totals map[string][2]int) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" || v.Field(i).Kind() != reflect.Slice {
+			continue
+		}
+
+		name := graph.FieldName(field)
+		if name == "" {
+			continue
+		}
+
+		key := v.Type().Name() + "." + name
+		total := totals[key]
+		total[0] += v.Field(i).Len()
+		total[1]++
+		totals[key] = total
+
+		for j := 0; j < v.Field(i).Len(); j++ {
+			collectSizes(v.Field(i).Index(j), totals)
+		}
+	}
+}
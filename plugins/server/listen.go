@@ -0,0 +1,167 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listen opens the listener described by Addr:
+//   - "host:port" listens on TCP
+//   - "unix:/path/to/socket" listens on a Unix domain socket
+//   - "systemd:" or "systemd:name" uses a socket passed by systemd socket activation
+func (s *Server) listen() (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(s.Addr, "unix:"):
+		return listenUnix(strings.TrimPrefix(s.Addr, "unix:"), s.SocketMode)
+	case strings.HasPrefix(s.Addr, "systemd:"):
+		return listenSystemd(strings.TrimPrefix(s.Addr, "systemd:"))
+	default:
+		return net.Listen("tcp", s.Addr)
+	}
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	certs := &certificate{cert: s.TLSCert, key: s.TLSKey}
+	if _, err := certs.get(nil); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.get,
+	}, nil
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: socket already in use", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+var systemd struct {
+	once  sync.Once
+	files []*os.File
+	names []string
+}
+
+// listenSystemd duplicates the socket so it can be listened on again after a
+// worker restart.
+func listenSystemd(name string) (net.Listener, error) {
+	systemd.once.Do(func() {
+		if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+			return
+		}
+
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil {
+			return
+		}
+
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < count; i++ {
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			}
+			systemd.files = append(systemd.files, os.NewFile(uintptr(3+i), name))
+			systemd.names = append(systemd.names, name)
+		}
+
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+
+	for i, file := range systemd.files {
+		if name == "" || systemd.names[i] == name {
+			return net.FileListener(file)
+		}
+	}
+
+	if name == "" {
+		return nil, errors.New("systemd: no socket passed")
+	}
+	return nil, fmt.Errorf("systemd: no socket named %s", name)
+}
+
+// certificate reloads the key pair when one of the files is modified.
+type certificate struct {
+	cert, key string
+
+	mu      sync.Mutex
+	current *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil && time.Since(c.checked) < time.Second {
+		return c.current, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := latestModTime(c.cert, c.key)
+	if err != nil {
+		if c.current != nil {
+			return c.current, nil
+		}
+		return nil, err
+	}
+
+	if c.current != nil && !modTime.After(c.modTime) {
+		return c.current, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cert, c.key)
+	if err != nil {
+		if c.current != nil {
+			return c.current, nil
+		}
+		return nil, err
+	}
+
+	c.current = &cert
+	c.modTime = modTime
+	return c.current, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
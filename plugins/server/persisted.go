@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PersistedQueries struct {
+	// Allowlist is a JSON file mapping sha256 hashes to queries, or an Apollo
+	// persisted query manifest. It is reloaded when modified.
+	Allowlist string
+	// Strict only executes the queries of the allowlist
+	Strict bool
+	// CacheSize is the number of automatically persisted queries kept in memory
+	CacheSize int
+
+	mu        sync.Mutex
+	allowed   map[string]string
+	modTime   time.Time
+	checked   time.Time
+	cache     map[string]*list.Element
+	evictions *list.List
+}
+
+type persistedEntry struct {
+	hash  string
+	query string
+}
+
+type persistedRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    struct {
+		PersistedQuery *struct {
+			Version    int    `json:"version"`
+			Sha256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+var (
+	errPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+	errHashMismatch           = errors.New("provided sha256Hash does not match query")
+	errNotAllowed             = errors.New("operation is not in the allowlist")
+)
+
+func hashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *PersistedQueries) load() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reload()
+}
+
+func (p *PersistedQueries) reload() error {
+	if p.Allowlist == "" || time.Since(p.checked) < time.Second {
+		return nil
+	}
+	p.checked = time.Now()
+
+	modTime, err := latestModTime(p.Allowlist)
+	if err != nil {
+		return err
+	}
+	if p.allowed != nil && !modTime.After(p.modTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(p.Allowlist)
+	if err != nil {
+		return err
+	}
+
+	queries, err := parseAllowlist(content)
+	if err != nil {
+		return err
+	}
+
+	p.allowed = map[string]string{}
+	for _, query := range queries {
+		p.allowed[hashQuery(query)] = query
+	}
+	p.modTime = modTime
+	return nil
+}
+
+func parseAllowlist(content []byte) ([]string, error) {
+	manifest := struct {
+		Operations []struct {
+			Body string `json:"body"`
+		} `json:"operations"`
+	}{}
+	if err := json.Unmarshal(content, &manifest); err == nil && manifest.Operations != nil {
+		queries := []string{}
+		for _, op := range manifest.Operations {
+			queries = append(queries, op.Body)
+		}
+		return queries, nil
+	}
+
+	hashes := map[string]string{}
+	if err := json.Unmarshal(content, &hashes); err != nil {
+		return nil, err
+	}
+
+	queries := []string{}
+	for _, query := range hashes {
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// resolve returns the query to execute for the request, registering it in the
+// cache when automatic persisted queries are allowed.
+func (p *PersistedQueries) resolve(req *persistedRequest) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.reload(); err != nil && p.allowed == nil {
+		return "", err
+	}
+
+	hash := ""
+	if req.Extensions.PersistedQuery != nil {
+		hash = strings.ToLower(req.Extensions.PersistedQuery.Sha256Hash)
+	}
+
+	if req.Query == "" {
+		if hash == "" {
+			return "", nil
+		}
+		if query, ok := p.allowed[hash]; ok {
+			return query, nil
+		}
+		if e, ok := p.cache[hash]; ok && !p.Strict {
+			p.evictions.MoveToFront(e)
+			return e.Value.(*persistedEntry).query, nil
+		}
+		return "", errPersistedQueryNotFound
+	}
+
+	actual := hashQuery(req.Query)
+	if hash != "" && hash != actual {
+		return "", errHashMismatch
+	}
+
+	if p.Strict {
+		if _, ok := p.allowed[actual]; !ok {
+			return "", errNotAllowed
+		}
+		return req.Query, nil
+	}
+
+	if hash != "" {
+		p.store(hash, req.Query)
+	}
+	return req.Query, nil
+}
+
+func (p *PersistedQueries) store(hash string, query string) {
+	if _, ok := p.allowed[hash]; ok {
+		return
+	}
+
+	if p.cache == nil {
+		p.cache = map[string]*list.Element{}
+		p.evictions = list.New()
+	}
+
+	if e, ok := p.cache[hash]; ok {
+		p.evictions.MoveToFront(e)
+		return
+	}
+
+	p.cache[hash] = p.evictions.PushFront(&persistedEntry{hash, query})
+
+	size := p.CacheSize
+	if size <= 0 {
+		size = 1000
+	}
+	for p.evictions.Len() > size {
+		oldest := p.evictions.Back()
+		p.evictions.Remove(oldest)
+		delete(p.cache, oldest.Value.(*persistedEntry).hash)
+	}
+}
+
+func (s *Server) persisted(next http.Handler) http.Handler {
+	if s.PersistedQueries == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := readPersistedRequest(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		query, err := s.PersistedQueries.resolve(req)
+		switch err {
+		case nil:
+		case errPersistedQueryNotFound:
+			writeCodedError(w, http.StatusOK, err, "PERSISTED_QUERY_NOT_FOUND")
+			return
+		case errNotAllowed:
+			writeCodedError(w, http.StatusForbidden, err, "OPERATION_NOT_ALLOWED")
+			return
+		default:
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		req.Query = query
+		body, err := json.Marshal(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// hand the resolved query over to the next handlers as a JSON POST
+		r = r.Clone(r.Context())
+		r.Method = http.MethodPost
+		r.URL.RawQuery = ""
+		r.Header.Set("Content-Type", "application/json")
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func readPersistedRequest(r *http.Request) (*persistedRequest, error) {
+	req := &persistedRequest{}
+
+	if values := r.URL.Query(); values.Get("query") != "" || values.Get("extensions") != "" {
+		req.Query = values.Get("query")
+		req.OperationName = values.Get("operationName")
+		if v := values.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return nil, err
+			}
+		}
+		if v := values.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Extensions); err != nil {
+				return nil, err
+			}
+		}
+		return req, nil
+	}
+
+	if r.Method != http.MethodPost || r.Body == nil {
+		return req, nil
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") || r.Header.Get("Content-Type") == "" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	opts, err := readOptions(r)
+	if err != nil {
+		return nil, err
+	}
+	req.Query = opts.Query
+	req.Variables = opts.Variables
+	req.OperationName = opts.OperationName
+	return req, nil
+}
+
+func writeCodedError(w http.ResponseWriter, status int, err error, code string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{{
+			"message":    err.Error(),
+			"extensions": map[string]string{"code": code},
+		}},
+	})
+}
@@ -6,22 +6,65 @@ import (
 	"net"
 	"net/http"
 	"net/http/fcgi"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/clementd64/tachiql/pkg/graph"
-	"github.com/graphql-go/handler"
 )
 
+type Listening struct {
+	Addr    net.Addr
+	FastCGI bool
+}
+
 type Server struct {
 	Addr                    string
 	Path                    string
+	HealthPath              string
+	ReadyPath               string
+	Explorer                bool
+	ExplorerPath            string
 	ShutdownTimeout         time.Duration
 	ShutdownTimeoutExceeded func(err error)
 	ServeMux                *http.ServeMux
 	FastCGI                 bool
+	TLSCert                 string
+	TLSKey                  string
+	SocketMode              os.FileMode
+	CORS                    *CORS
+	Compression             bool
+	CacheControl            string
+	Auth                    Authenticator
+	Anonymous               *Principal
+	Limits                  *Limits
+	PersistedQueries        *PersistedQueries
+
+	once     sync.Once
+	setupErr error
+	errors   pluginErrors
+}
+
+func (s *Server) Schema(g *graph.Graph) error {
+	g.Events.Subscribe(s.errors.record)
+	return nil
 }
 
 func (s *Server) Worker(ctx context.Context, t *graph.Graph) error {
+	s.once.Do(func() { s.setupErr = s.setup(t) })
+	if s.setupErr != nil {
+		return s.setupErr
+	}
+
+	if s.FastCGI {
+		return s.serveFcgi(ctx, t)
+	}
+
+	return s.serveHTTP(ctx, t)
+}
+
+func (s *Server) setup(t *graph.Graph) error {
 	if s.ServeMux == nil {
 		s.ServeMux = http.NewServeMux()
 	}
@@ -34,6 +77,26 @@ func (s *Server) Worker(ctx context.Context, t *graph.Graph) error {
 		s.Path = "/"
 	}
 
+	if s.HealthPath == "" {
+		s.HealthPath = "/healthz"
+	}
+
+	if s.ReadyPath == "" {
+		s.ReadyPath = "/readyz"
+	}
+
+	if s.ExplorerPath == "" {
+		s.ExplorerPath = "/explorer/"
+	}
+
+	if !strings.HasSuffix(s.ExplorerPath, "/") {
+		s.ExplorerPath += "/"
+	}
+
+	if s.CacheControl == "" {
+		s.CacheControl = "no-cache"
+	}
+
 	if s.ShutdownTimeout == 0 {
 		s.ShutdownTimeout = 5 * time.Second
 	}
@@ -44,51 +107,123 @@ func (s *Server) Worker(ctx context.Context, t *graph.Graph) error {
 		}
 	}
 
-	s.ServeMux.Handle(s.Path, handler.New(&handler.Config{
-		Schema: &t.Schema,
-		RootObjectFn: func(ctx context.Context, r *http.Request) map[string]interface{} {
-			return graph.ToMap(t.Root)
-		},
-	}))
+	if s.CORS != nil {
+		if err := s.CORS.validate(); err != nil {
+			return err
+		}
+	}
 
-	if s.FastCGI {
-		return s.serveFcgi(ctx)
+	if s.PersistedQueries != nil {
+		if err := s.PersistedQueries.load(); err != nil {
+			return err
+		}
+	}
+
+	if s.Auth != nil || s.Anonymous != nil {
+		restrictTypes(t)
+	}
+
+	var h http.Handler = s.graphqlHandler(t)
+	h = s.limit(t, h)
+	h = s.persisted(h)
+	h = s.cache(t, h)
+	h = s.compress(h)
+	h = s.authenticate(h)
+	h = s.cors(h)
+	s.ServeMux.Handle(s.Path, h)
+	s.ServeMux.Handle(s.HealthPath, s.healthHandler(t, false))
+	s.ServeMux.Handle(s.ReadyPath, s.healthHandler(t, true))
+
+	if s.Explorer {
+		s.ServeMux.Handle(s.ExplorerPath, s.authenticate(s.compress(s.explorerHandler())))
 	}
 
-	return s.serveHTTP(ctx)
+	return nil
+}
+
+// Handle registers a handler of another plugin, such as the metrics. It
+// requires the same authentication as the GraphQL endpoint.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.HandlePublic(pattern, s.authenticate(handler))
+}
+
+// HandlePublic registers a handler of another plugin without authentication,
+// for resources browsers load without credentials such as images.
+func (s *Server) HandlePublic(pattern string, handler http.Handler) {
+	if s.ServeMux == nil {
+		s.ServeMux = http.NewServeMux()
+	}
+	s.ServeMux.Handle(pattern, handler)
 }
 
-func (s *Server) serveHTTP(ctx context.Context) error {
+func (s *Server) serveHTTP(ctx context.Context, t *graph.Graph) error {
 	srv := &http.Server{
-		Addr:    s.Addr,
 		Handler: s.ServeMux,
 	}
 
+	if s.TLSCert != "" {
+		config, err := s.tlsConfig()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = config
+	}
+
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
 		timeout, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
 		defer cancel()
 		if err := srv.Shutdown(timeout); err != nil {
+			t.Events.Publish(graph.PluginError{Plugin: graph.PluginName(s), Err: err})
 			s.ShutdownTimeoutExceeded(err)
 		}
 	}()
 
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	t.Events.Publish(Listening{Addr: l.Addr()})
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(l, "", "")
+	} else {
+		err = srv.Serve(l)
+	}
+	if err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
-func (s *Server) serveFcgi(ctx context.Context) error {
-	l, err := net.Listen("tcp", s.Addr)
+func (s *Server) serveFcgi(ctx context.Context, t *graph.Graph) error {
+	l, err := s.listen()
 	if err != nil {
 		return err
 	}
 
+	t.Events.Publish(Listening{Addr: l.Addr(), FastCGI: true})
+
+	done := make(chan struct{})
+	defer close(done)
+
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
 		l.Close()
 	}()
 
-	return fcgi.Serve(l, s.ServeMux)
+	if err := fcgi.Serve(l, s.ServeMux); ctx.Err() == nil {
+		return err
+	}
+	return nil
 }
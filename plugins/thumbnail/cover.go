@@ -0,0 +1,93 @@
+package thumbnail
+
+import (
+	"strconv"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"github.com/graphql-go/graphql"
+)
+
+// cover is the thumbnail currently served for a manga, along with the cache
+// entry it comes from, or the placeholder of a manga without thumbnail.
+type cover struct {
+	entry       Entry
+	placeholder string
+}
+
+func (t *Thumbnail) cover(manga *backup.Manga) (*cover, bool) {
+	id := mangaId(manga)
+	file, ok := t.file(id)
+	if !ok {
+		if placeholder := t.placeholder(manga); placeholder != "" {
+			return &cover{placeholder: placeholder}, true
+		}
+		return nil, false
+	}
+
+	entry, ok := t.index.get(id)
+	if !ok || entry.Filename != file {
+		entry = Entry{Filename: file}
+	}
+	return &cover{entry: entry}, true
+}
+
+func (t *Thumbnail) url(c *cover, size Size) string {
+	if c.placeholder != "" {
+		return c.placeholder
+	}
+
+	url := c.entry.Filename
+	// variants fall back to the original until they are generated
+	if variant, ok := c.entry.Variants[size]; ok {
+		url = variant
+	}
+	// refreshed thumbnails get a new URL, as they are served immutable
+	if c.entry.Revision > 0 {
+		url += "?v=" + strconv.Itoa(c.entry.Revision)
+	}
+	return t.config.Prefix + url
+}
+
+var sizeArgs = graphql.FieldConfigArgument{
+	"size": &graphql.ArgumentConfig{
+		Type:         sizeEnum,
+		DefaultValue: Original,
+	},
+}
+
+func (t *Thumbnail) coverType() *graphql.Object {
+	field := func(typ graphql.Output, value func(Entry) interface{}) *graphql.Field {
+		return &graphql.Field{
+			Type: typ,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return value(p.Source.(*cover).entry), nil
+			},
+		}
+	}
+
+	optional := func(v interface{}) interface{} {
+		if v == 0 || v == int64(0) || v == "" {
+			return nil
+		}
+		return v
+	}
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Cover",
+		Fields: graphql.Fields{
+			"url": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Args: sizeArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return t.url(p.Source.(*cover), p.Args["size"].(Size)), nil
+				},
+			},
+			"width":       field(graphql.Int, func(e Entry) interface{} { return optional(e.Width) }),
+			"height":      field(graphql.Int, func(e Entry) interface{} { return optional(e.Height) }),
+			"byteSize":    field(graphql.Int, func(e Entry) interface{} { return optional(e.Size) }),
+			"color":       field(graphql.String, func(e Entry) interface{} { return optional(e.Color) }),
+			"blurhash":    field(graphql.String, func(e Entry) interface{} { return optional(e.BlurHash) }),
+			"contentType": field(graphql.String, func(e Entry) interface{} { return optional(e.ContentType) }),
+		},
+	})
+}
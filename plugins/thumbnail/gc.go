@@ -0,0 +1,150 @@
+package thumbnail
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+)
+
+type GC struct {
+	// DryRun only reports the orphaned thumbnails
+	DryRun bool
+	// Trash is the store orphaned thumbnails are moved to, they are removed
+	// right away when nil
+	Trash Store
+	// GracePeriod is how long thumbnails stay in the trash
+	GracePeriod time.Duration
+}
+
+type GCReport struct {
+	// Orphans are the thumbnails no longer referenced by the backup
+	Orphans []string
+	Size    int64
+	// Purged are the thumbnails removed from the trash
+	Purged     []string
+	PurgedSize int64
+}
+
+// Collected is published when orphaned thumbnails are collected.
+type Collected struct {
+	Report *GCReport
+}
+
+// CollectGarbage removes the thumbnails not referenced by mangas from the
+// cache directory, and the thumbnails older than the grace period from the
+// trash.
+func (t *Thumbnail) CollectGarbage(mangas []*backup.Manga, gc GC) (*GCReport, error) {
+	if err := t.index.load(); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, manga := range mangas {
+		// local source covers are kept even when LocalSource is not set, as
+		// they can not be downloaded again
+		if t.hasThumbnail(manga) || manga.GetSource() == localSource {
+			referenced[t.config.Filename(manga)] = true
+		}
+	}
+
+	files, err := t.config.Store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if dir, ok := gc.Trash.(Dir); ok && !gc.DryRun {
+		if err := os.MkdirAll(string(dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &GCReport{}
+	for _, file := range files {
+		if referenced[stem(file.Name)] || t.isIndex(file.Name) {
+			continue
+		}
+
+		if !gc.DryRun {
+			if err := t.collectFile(file.Name, gc.Trash); err != nil {
+				return report, err
+			}
+			t.index.removeFile(file.Name)
+		}
+
+		report.Orphans = append(report.Orphans, file.Name)
+		report.Size += file.Size
+	}
+
+	if err := t.index.save(); err != nil {
+		return report, err
+	}
+
+	if gc.Trash != nil {
+		if err := purge(gc, report); err != nil {
+			return report, err
+		}
+	}
+
+	if !gc.DryRun {
+		t.publish(Collected{Report: report})
+	}
+	return report, nil
+}
+
+// isIndex reports whether the file is the persisted index, when it is kept
+// along the thumbnails.
+func (t *Thumbnail) isIndex(name string) bool {
+	dir, ok := t.config.Store.(Dir)
+	return ok && t.config.Index != "" && path.Join(string(dir), name) == path.Clean(t.config.Index)
+}
+
+// collectFile moves the file to the trash, or removes it when there is none.
+func (t *Thumbnail) collectFile(name string, trash Store) error {
+	if trash != nil {
+		file, err := t.config.Store.Get(name)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		// the trash modification time tracks how long the file has been there
+		if err := trash.Put(name, content); err != nil {
+			return err
+		}
+	}
+	return t.config.Store.Delete(name)
+}
+
+func purge(gc GC, report *GCReport) error {
+	files, err := gc.Trash.List()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if time.Since(file.ModTime) < gc.GracePeriod {
+			continue
+		}
+
+		if !gc.DryRun {
+			if err := gc.Trash.Delete(file.Name); err != nil {
+				return err
+			}
+		}
+
+		report.Purged = append(report.Purged, file.Name)
+		report.PurgedSize += file.Size
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package thumbnail
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry describes a thumbnail of the cache directory.
+type Entry struct {
+	ID          ID        `json:"id"`
+	Filename    string    `json:"filename"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ContentType string    `json:"contentType"`
+	Url         string    `json:"url"`
+	// ETag and LastModified validate the thumbnail against its URL
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Revision is incremented each time the thumbnail changes
+	Revision int `json:"revision,omitempty"`
+	// Hash is the hex encoded SHA-256 of the thumbnail
+	Hash string `json:"hash,omitempty"`
+	// Variants are the filenames of the resized thumbnails
+	Variants map[Size]string `json:"variants,omitempty"`
+
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Color    string `json:"color,omitempty"`
+	BlurHash string `json:"blurhash,omitempty"`
+
+	decoded bool
+}
+
+// stem returns the filename without extension nor variant.
+func stem(filename string) string {
+	if i := strings.Index(filename, "."); i >= 0 {
+		return filename[:i]
+	}
+	return filename
+}
+
+// index keeps the content of the store in memory, so looking up a thumbnail
+// does not list the whole store.
+type index struct {
+	store Store
+	file  string
+
+	mu      sync.Mutex
+	loaded  bool
+	dirty   bool
+	entries map[ID]Entry
+	// unclaimed holds the files of the store that are not yet associated to a
+	// manga, by filename without extension
+	unclaimed map[string]Entry
+}
+
+func (i *index) load() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.loaded {
+		return nil
+	}
+
+	list, err := i.store.List()
+	if err != nil {
+		return err
+	}
+
+	files := map[string]Entry{}
+	variants := map[string]map[Size]string{}
+	for _, file := range list {
+		if parts := strings.SplitN(file.Name, ".", 3); len(parts) == 3 {
+			if variants[parts[0]] == nil {
+				variants[parts[0]] = map[Size]string{}
+			}
+			variants[parts[0]][Size(parts[1])] = file.Name
+			continue
+		}
+		files[file.Name] = Entry{
+			Filename:    file.Name,
+			Size:        file.Size,
+			ModTime:     file.ModTime,
+			ContentType: mime.TypeByExtension(path.Ext(file.Name)),
+		}
+	}
+
+	persisted := []Entry{}
+	if i.file != "" {
+		content, err := ioutil.ReadFile(i.file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(content, &persisted); err != nil {
+				return err
+			}
+		}
+	}
+
+	i.entries = map[ID]Entry{}
+	for _, entry := range persisted {
+		file, ok := files[entry.Filename]
+		if !ok {
+			i.dirty = true
+			continue
+		}
+		entry.Size = file.Size
+		entry.ModTime = file.ModTime
+		entry.Variants = variants[stem(entry.Filename)]
+		i.entries[entry.ID] = entry
+		delete(files, entry.Filename)
+	}
+
+	i.unclaimed = map[string]Entry{}
+	for name, entry := range files {
+		entry.Variants = variants[stem(name)]
+		i.unclaimed[stem(name)] = entry
+	}
+
+	i.loaded = true
+	return nil
+}
+
+// lookup returns the thumbnail of id, claiming the file named filename from
+// the directory when the index does not know it yet.
+func (i *index) lookup(id ID, filename string, url string) (Entry, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if entry, ok := i.entries[id]; ok {
+		return entry, true
+	}
+
+	entry, ok := i.unclaimed[filename]
+	if !ok {
+		return Entry{}, false
+	}
+
+	delete(i.unclaimed, filename)
+	entry.ID = id
+	entry.Url = url
+	i.entries[id] = entry
+	i.dirty = true
+	return entry, true
+}
+
+func (i *index) get(id ID) (Entry, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.entries[id]
+	return entry, ok
+}
+
+func (i *index) add(entry Entry) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.entries == nil {
+		i.entries = map[ID]Entry{}
+	}
+	i.entries[entry.ID] = entry
+	i.dirty = true
+}
+
+// removeFile forgets the thumbnail stored in the file name.
+func (i *index) removeFile(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for id, entry := range i.entries {
+		if entry.Filename == name {
+			delete(i.entries, id)
+			i.dirty = true
+		}
+	}
+	delete(i.unclaimed, stem(name))
+}
+
+// save persists the index when it changed since the last save.
+func (i *index) save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.file == "" || !i.dirty {
+		return nil
+	}
+
+	entries := []Entry{}
+	for _, entry := range i.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Filename < entries[b].Filename })
+
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := i.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, i.file); err != nil {
+		return err
+	}
+
+	i.dirty = false
+	return nil
+}
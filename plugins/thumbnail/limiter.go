@@ -0,0 +1,39 @@
+package thumbnail
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces the requests sent to the same host by interval.
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func (h *hostLimiter) wait(ctx context.Context, host string) error {
+	if h.interval <= 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	if h.next == nil {
+		h.next = map[string]time.Time{}
+	}
+	now := time.Now()
+	at := h.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	h.next[host] = at.Add(h.interval)
+	h.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(at)):
+		return nil
+	}
+}
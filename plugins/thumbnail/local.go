@@ -0,0 +1,70 @@
+package thumbnail
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+)
+
+// localSource is the ID of the Tachiyomi local source.
+const localSource = 0
+
+// hasThumbnail reports whether a thumbnail can be found for the manga, local
+// source mangas may have none in the backup but a cover in their folder.
+func (t *Thumbnail) hasThumbnail(manga *backup.Manga) bool {
+	return manga.ThumbnailUrl != nil || (t.config.LocalSource != "" && manga.GetSource() == localSource)
+}
+
+// local returns the cover of the manga stored by Tachiyomi, either in its
+// cover cache or in the folder of a local source manga. The cached thumbnail
+// is not modified when it is more recent than the local cover.
+func (t *Thumbnail) local(manga *backup.Manga, cached *Entry) (*response, bool) {
+	filename := ""
+	if t.config.LocalSource != "" && manga.GetSource() == localSource {
+		filename = localCover(path.Join(t.config.LocalSource, path.Clean("/"+manga.GetUrl())))
+	}
+	if filename == "" && t.config.CoverCache != "" && manga.ThumbnailUrl != nil {
+		// Tachiyomi names the cached covers after the MD5 of their URL
+		sum := md5.Sum([]byte(manga.GetThumbnailUrl()))
+		filename = path.Join(t.config.CoverCache, hex.EncodeToString(sum[:]))
+	}
+	if filename == "" {
+		return nil, false
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+
+	if cached != nil && cached.Url == manga.GetThumbnailUrl() && !info.ModTime().After(cached.ModTime) {
+		return &response{notModified: true}, true
+	}
+
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	return &response{body: body}, true
+}
+
+// localCover returns the cover file of a local source manga folder.
+func localCover(dir string) string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, file := range files {
+		name := strings.ToLower(file.Name())
+		if strings.TrimSuffix(name, path.Ext(name)) == "cover" && file.Type().IsRegular() {
+			return path.Join(dir, file.Name())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+)
+
+// sample is the width of the image the color and blurhash are computed on.
+const sample = 32
+
+// needsDecoding reports whether the metadata or some variants of the
+// thumbnail are missing. Thumbnails are decoded at most once per run.
+func (t *Thumbnail) needsDecoding(entry *Entry) bool {
+	if entry.decoded {
+		return false
+	}
+	if entry.Width == 0 {
+		return true
+	}
+	for size := range t.config.Variants {
+		if _, ok := entry.Variants[size]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decode computes the metadata and generates the variants of a thumbnail,
+// from img when it was already decoded or from the store otherwise.
+func (t *Thumbnail) decode(entry Entry, img image.Image) bool {
+	if !t.needsDecoding(&entry) {
+		return false
+	}
+
+	entry.decoded = true
+	if err := t.process(&entry, img); err != nil {
+		log.Print(err)
+	}
+	t.index.add(entry)
+	return true
+}
+
+// decodeAll decodes the cached thumbnails of the mangas, such as the ones
+// cached before variants were configured. It runs in the worker so a reload
+// only decodes the thumbnails it downloads.
+func (t *Thumbnail) decodeAll(ctx context.Context, mangas []*backup.Manga) bool {
+	decoded := false
+	for _, manga := range mangas {
+		if ctx.Err() != nil {
+			break
+		}
+		if entry, ok := t.index.get(mangaId(manga)); ok && t.decode(entry, nil) {
+			decoded = true
+		}
+	}
+
+	if decoded {
+		if err := t.index.save(); err != nil {
+			log.Print(err)
+		}
+	}
+	return decoded
+}
+
+func (t *Thumbnail) process(entry *Entry, src image.Image) error {
+	if src == nil {
+		file, err := t.config.Store.Get(entry.Filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		src, _, err = image.Decode(file)
+		if err != nil {
+			return errors.New("failed to decode thumbnail " + entry.Filename + ": " + err.Error())
+		}
+	}
+
+	analyze(entry, src)
+
+	entry.Variants = map[Size]string{}
+	for size, width := range t.config.Variants {
+		content, err := t.encode(scale(src, width))
+		if err != nil {
+			return err
+		}
+
+		name := t.variantName(entry.Filename, size)
+		if err := t.config.Store.Put(name, content); err != nil {
+			return err
+		}
+		entry.Variants[size] = name
+	}
+	return nil
+}
+
+// analyze fills the dimensions, dominant color and blurhash of the entry.
+func analyze(entry *Entry, img image.Image) {
+	bounds := img.Bounds()
+	entry.Width = bounds.Dx()
+	entry.Height = bounds.Dy()
+
+	small := scale(img, sample)
+	entry.Color = dominantColor(small)
+
+	x, y := 4, 3
+	if entry.Height > entry.Width {
+		x, y = 3, 4
+	}
+	entry.BlurHash = blurHash(small, x, y)
+}
+
+// dominantColor returns the average of the most common colors, quantized to
+// 4 bits per channel.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b uint32
+	}
+
+	buckets := map[uint32]*bucket{}
+	var best *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			r, g, b = r>>8, g>>8, b>>8
+
+			key := r>>4<<8 | g>>4<<4 | b>>4
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	n := uint32(best.count)
+	return fmt.Sprintf("#%02x%02x%02x", best.r/n, best.g/n, best.b/n)
+}
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHash encodes the image with x by y components, see
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+func blurHash(img image.Image, x int, y int) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	factors := make([][3]float64, 0, x*y)
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for py := 0; py < height; py++ {
+				for px := 0; px < width; px++ {
+					basis := math.Cos(math.Pi*float64(i*px)/float64(width)) * math.Cos(math.Pi*float64(j*py)/float64(height))
+					r, g, b, _ := img.At(bounds.Min.X+px, bounds.Min.Y+py).RGBA()
+					factor[0] += basis * srgbToLinear(r>>8)
+					factor[1] += basis * srgbToLinear(g>>8)
+					factor[2] += basis * srgbToLinear(b>>8)
+				}
+			}
+
+			norm := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * norm, factor[1] * norm, factor[2] * norm})
+		}
+	}
+
+	hash := &strings.Builder{}
+	encode83(hash, (x-1)+(y-1)*9, 1)
+
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, factor := range factors[1:] {
+			for _, v := range factor {
+				actual = math.Max(actual, math.Abs(v))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		encode83(hash, quantised, 1)
+	} else {
+		encode83(hash, 0, 1)
+	}
+
+	dc := factors[0]
+	encode83(hash, linearToSrgb(dc[0])<<16|linearToSrgb(dc[1])<<8|linearToSrgb(dc[2]), 4)
+
+	for _, factor := range factors[1:] {
+		q := [3]int{}
+		for c, v := range factor {
+			q[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(hash, q[0]*19*19+q[1]*19+q[2], 2)
+	}
+
+	return hash.String()
+}
+
+func encode83(hash *strings.Builder, value int, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		hash.WriteByte(base83[digit])
+	}
+}
+
+func srgbToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
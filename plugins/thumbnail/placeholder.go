@@ -0,0 +1,145 @@
+package thumbnail
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"github.com/graphql-go/graphql"
+)
+
+// placeholderName is the file ServeHTTP generates placeholders as.
+const placeholderName = "placeholder.svg"
+
+var colorPattern = regexp.MustCompile(`^[0-9a-f]{6}$`)
+
+// placeholder returns the URL of the cover served for a manga without
+// thumbnail, or an empty string when there is none.
+func (t *Thumbnail) placeholder(manga *backup.Manga) string {
+	if t.config.DefaultCover != "" {
+		return t.config.DefaultCover
+	}
+	if !t.config.Placeholder {
+		return ""
+	}
+
+	query := url.Values{
+		"initials": {initials(manga.GetTitle())},
+		"color":    {placeholderColor(mangaId(manga))},
+	}
+	return t.config.Prefix + placeholderName + "?" + query.Encode()
+}
+
+// initials returns the first letter of the first two words of the title.
+func initials(title string) string {
+	letters := []rune{}
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+		r, _ := utf8.DecodeRuneInString(word)
+		letters = append(letters, unicode.ToUpper(r))
+		if len(letters) == 2 {
+			break
+		}
+	}
+	return string(letters)
+}
+
+// placeholderColor derives a color from the manga ID, so a manga keeps the
+// same placeholder.
+func placeholderColor(id ID) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%s", id.Source, id.Url)
+	hue := float64(h.Sum32()%360) / 60
+
+	// HSL to RGB with a 50% saturation and 45% lightness
+	c := 0.45
+	x := c * (1 - math.Abs(math.Mod(hue, 2)-1))
+	m := 0.45 - c/2
+
+	rgb := [6][3]float64{{c, x, 0}, {x, c, 0}, {0, c, x}, {0, x, c}, {x, 0, c}, {c, 0, x}}[int(hue)]
+	return fmt.Sprintf("%02x%02x%02x", int((rgb[0]+m)*255), int((rgb[1]+m)*255), int((rgb[2]+m)*255))
+}
+
+func servePlaceholder(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	color := query.Get("color")
+	if !colorPattern.MatchString(color) {
+		color = "808080"
+	}
+
+	text := []rune(query.Get("initials"))
+	if len(text) > 2 {
+		text = text[:2]
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprint(w, `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="450" viewBox="0 0 300 450">`+
+		`<rect width="300" height="450" fill="#`+color+`"/>`+
+		`<text x="150" y="225" dominant-baseline="central" text-anchor="middle" font-family="sans-serif" font-size="120" fill="#fff">`+
+		html.EscapeString(string(text))+`</text></svg>`)
+}
+
+type Status string
+
+const (
+	StatusCached  Status = "CACHED"
+	StatusPending Status = "PENDING"
+	StatusFailed  Status = "FAILED"
+	StatusMissing Status = "MISSING"
+)
+
+var statusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ThumbnailStatus",
+	Values: graphql.EnumValueConfigMap{
+		"CACHED":  &graphql.EnumValueConfig{Value: StatusCached},
+		"PENDING": &graphql.EnumValueConfig{Value: StatusPending},
+		"FAILED":  &graphql.EnumValueConfig{Value: StatusFailed},
+		"MISSING": &graphql.EnumValueConfig{Value: StatusMissing},
+	},
+})
+
+func (t *Thumbnail) status(manga *backup.Manga) (Status, error) {
+	id := mangaId(manga)
+	if _, ok := t.file(id); ok {
+		return StatusCached, t.failure(id)
+	}
+	if !t.hasThumbnail(manga) {
+		return StatusMissing, nil
+	}
+	if err := t.failure(id); err != nil {
+		return StatusFailed, err
+	}
+	return StatusPending, nil
+}
+
+func (t *Thumbnail) failure(id ID) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.failures[id]
+}
+
+// setFailure records the last error of the thumbnail download, a nil error
+// clears it.
+func (t *Thumbnail) setFailure(id ID, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil {
+		delete(t.failures, id)
+		return
+	}
+	if t.failures == nil {
+		t.failures = map[ID]error{}
+	}
+	t.failures[id] = err
+}
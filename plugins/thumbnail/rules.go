@@ -0,0 +1,147 @@
+package thumbnail
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+)
+
+// Rule customizes the thumbnail requests of a source. A rule without Source
+// nor Name applies to every source.
+type Rule struct {
+	// Source is the ID of the source
+	Source *int64 `json:"source,omitempty"`
+	// Name is the name of the source in the backup
+	Name    string            `json:"name,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Rewrites are applied in order to the thumbnail URL
+	Rewrites []Rewrite `json:"rewrites,omitempty"`
+	// Proxy is the URL of the proxy the requests go through
+	Proxy string `json:"proxy,omitempty"`
+}
+
+type Rewrite struct {
+	// Match is a regular expression, Replace can reference its groups as $1
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// LoadRules reads a JSON file holding a list of rules.
+func LoadRules(filename string) ([]Rule, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []Rule{}
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type rule struct {
+	Rule
+	rewrites []*regexp.Regexp
+	client   *http.Client
+}
+
+type ruleSet struct {
+	// err is the error of compile, reported by Schema
+	err   error
+	rules []*rule
+
+	mu      sync.RWMutex
+	sources map[int64]string
+}
+
+// compile prepares the rules of the config, it is called once by New.
+func (r *ruleSet) compile(config Config) {
+	for i, src := range config.Rules {
+		compiled := &rule{Rule: src}
+		for _, rewrite := range src.Rewrites {
+			re, err := regexp.Compile(rewrite.Match)
+			if err != nil {
+				r.err = errors.New("thumbnail: rule " + strconv.Itoa(i) + ": " + err.Error())
+				return
+			}
+			compiled.rewrites = append(compiled.rewrites, re)
+		}
+
+		if src.Proxy != "" {
+			proxy, err := url.Parse(src.Proxy)
+			if err != nil {
+				r.err = errors.New("thumbnail: rule " + strconv.Itoa(i) + ": " + err.Error())
+				return
+			}
+			compiled.client = &http.Client{
+				Timeout:   config.Timeout,
+				Transport: &http.Transport{Proxy: http.ProxyURL(proxy)},
+			}
+		}
+		r.rules = append(r.rules, compiled)
+	}
+}
+
+// setSources remembers the names of the sources of the backup.
+func (r *ruleSet) setSources(sources []*backup.Source) {
+	names := map[int64]string{}
+	for _, source := range sources {
+		names[source.GetSourceId()] = source.GetName()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources = names
+}
+
+func (r *ruleSet) match(rule *rule, source int64) bool {
+	if rule.Source != nil && *rule.Source != source {
+		return false
+	}
+	if rule.Name != "" {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.sources[source] == rule.Name
+	}
+	return true
+}
+
+// apply customizes the request of the manga thumbnail, and returns the client
+// to send it with.
+func (r *ruleSet) apply(req *http.Request, manga *backup.Manga, client *http.Client) (*http.Client, error) {
+	for _, rule := range r.rules {
+		if !r.match(rule, manga.GetSource()) {
+			continue
+		}
+
+		if len(rule.rewrites) > 0 {
+			rawurl := req.URL.String()
+			for i, re := range rule.rewrites {
+				rawurl = re.ReplaceAllString(rawurl, rule.Rewrites[i].Replace)
+			}
+			u, err := url.Parse(rawurl)
+			if err != nil {
+				return nil, err
+			}
+			req.URL = u
+			req.Host = u.Host
+		}
+
+		for name, value := range rule.Headers {
+			req.Header.Set(name, value)
+		}
+
+		if rule.client != nil {
+			client = rule.client
+		}
+	}
+	return client, nil
+}
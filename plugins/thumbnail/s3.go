@@ -0,0 +1,226 @@
+package thumbnail
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 stores the thumbnails in an S3 compatible bucket, using path-style
+// requests signed with AWS Signature Version 4.
+type S3 struct {
+	// Endpoint is the URL of the service, such as https://s3.eu-west-1.amazonaws.com
+	Endpoint string
+	// Region defaults to us-east-1
+	Region string
+	Bucket string
+	// Prefix is prepended to the name of the objects
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	res, err := s.do(http.MethodGet, s.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(res, name); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Put(name string, content []byte) error {
+	header := http.Header{}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(http.MethodPut, s.Prefix+name, nil, content, header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, name)
+}
+
+func (s *S3) Delete(name string) error {
+	res, err := s.do(http.MethodDelete, s.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, name)
+}
+
+func (s *S3) Stat(name string) (FileInfo, error) {
+	res, err := s.do(http.MethodHead, s.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer res.Body.Close()
+	if err := s.check(res, name); err != nil {
+		return FileInfo{}, err
+	}
+
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return FileInfo{name, res.ContentLength, modTime}, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3) List() ([]FileInfo, error) {
+	files := []FileInfo{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := listBucketResult{}
+		err = s.check(res, "")
+		if err == nil {
+			err = xml.NewDecoder(res.Body).Decode(&result)
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.Prefix)
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			files = append(files, FileInfo{name, object.Size, object.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3) check(res *http.Response, name string) error {
+	switch {
+	case res.StatusCode == http.StatusNotFound && name != "":
+		return &fs.PathError{Op: strings.ToLower(res.Request.Method), Path: name, Err: fs.ErrNotExist}
+	case res.StatusCode >= 300:
+		return &StatusError{res.Request.URL.String(), res.StatusCode}
+	}
+	return nil
+}
+
+func (s *S3) do(method string, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+
+	req.Header.Set("X-Amz-Date", timestamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.Join(values, ",")
+	}
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
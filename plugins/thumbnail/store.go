@@ -0,0 +1,155 @@
+package thumbnail
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds the thumbnail files. Get and Stat return an error matching
+// fs.ErrNotExist for missing files.
+type Store interface {
+	Get(name string) (io.ReadCloser, error)
+	Put(name string, content []byte) error
+	Delete(name string) error
+	List() ([]FileInfo, error)
+	Stat(name string) (FileInfo, error)
+}
+
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Dir stores the thumbnails in a local directory. Files are written to a
+// temporary file first, so an interrupted write never leaves a truncated
+// thumbnail.
+type Dir string
+
+func (d Dir) Get(name string) (io.ReadCloser, error) {
+	return os.Open(path.Join(string(d), name))
+}
+
+func (d Dir) Put(name string, content []byte) error {
+	tmp := path.Join(string(d), "."+name+".tmp")
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path.Join(string(d), name))
+}
+
+func (d Dir) Delete(name string) error {
+	return os.Remove(path.Join(string(d), name))
+}
+
+func (d Dir) List() ([]FileInfo, error) {
+	dir, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileInfo{}
+	for _, file := range dir {
+		// leftovers of interrupted writes
+		if strings.HasPrefix(file.Name(), ".") && strings.HasSuffix(file.Name(), ".tmp") {
+			os.Remove(path.Join(string(d), file.Name()))
+			continue
+		}
+		if strings.HasPrefix(file.Name(), ".") || !file.Type().IsRegular() {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, FileInfo{file.Name(), info.Size(), info.ModTime()})
+	}
+	return files, nil
+}
+
+func (d Dir) Stat(name string) (FileInfo, error) {
+	info, err := os.Stat(path.Join(string(d), name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return FileInfo{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return FileInfo{name, info.Size(), info.ModTime()}, nil
+}
+
+// Memory stores the thumbnails in memory, the zero value is an empty store.
+type Memory struct {
+	mu    sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	content []byte
+	modTime time.Time
+}
+
+func (m *Memory) Get(name string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "get", Path: name, Err: fs.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(file.content)), nil
+}
+
+func (m *Memory) Put(name string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.files == nil {
+		m.files = map[string]memoryFile{}
+	}
+	m.files[name] = memoryFile{append([]byte(nil), content...), time.Now()}
+	return nil
+}
+
+func (m *Memory) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "delete", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *Memory) List() ([]FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	files := []FileInfo{}
+	for name, file := range m.files {
+		files = append(files, FileInfo{name, int64(len(file.content)), file.modTime})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (m *Memory) Stat(name string) (FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.files[name]
+	if !ok {
+		return FileInfo{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return FileInfo{name, int64(len(file.content)), file.modTime}, nil
+}
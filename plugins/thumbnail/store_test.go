@@ -0,0 +1,132 @@
+package thumbnail
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+func readFile(t *testing.T, store Store, name string) string {
+	t.Helper()
+
+	file, err := store.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", name, err)
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func listNames(t *testing.T, store Store) []string {
+	t.Helper()
+
+	files, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// testStore checks the behavior every Store implementation shares.
+func testStore(t *testing.T, store Store) {
+	if _, err := store.Get("a.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a missing file returned %v, want fs.ErrNotExist", err)
+	}
+	if _, err := store.Stat("a.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing file returned %v, want fs.ErrNotExist", err)
+	}
+	if names := listNames(t, store); len(names) != 0 {
+		t.Errorf("List of an empty store returned %v", names)
+	}
+
+	if err := store.Put("a.jpg", []byte("first")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put("b.png", []byte("second")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if content := readFile(t, store, "a.jpg"); content != "first" {
+		t.Errorf("Get returned %q, want %q", content, "first")
+	}
+
+	info, err := store.Stat("b.png")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Name != "b.png" || info.Size != int64(len("second")) || info.ModTime.IsZero() {
+		t.Errorf("Stat returned %+v", info)
+	}
+
+	if names := listNames(t, store); len(names) != 2 || names[0] != "a.jpg" || names[1] != "b.png" {
+		t.Errorf("List returned %v, want [a.jpg b.png]", names)
+	}
+
+	if err := store.Put("a.jpg", []byte("replaced")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if content := readFile(t, store, "a.jpg"); content != "replaced" {
+		t.Errorf("Get after overwrite returned %q, want %q", content, "replaced")
+	}
+
+	if err := store.Delete("a.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("a.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a deleted file returned %v, want fs.ErrNotExist", err)
+	}
+	if names := listNames(t, store); len(names) != 1 || names[0] != "b.png" {
+		t.Errorf("List after Delete returned %v, want [b.png]", names)
+	}
+}
+
+func TestDir(t *testing.T) {
+	testStore(t, Dir(t.TempDir()))
+}
+
+func TestDirList(t *testing.T) {
+	dir := t.TempDir()
+	store := Dir(dir)
+
+	// leftover of an interrupted Put, a hidden file and a sub directory
+	for _, name := range []string{".a.jpg.tmp", ".hidden"} {
+		if err := os.WriteFile(path.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(path.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("a.jpg", []byte("cover")); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := listNames(t, store); len(names) != 1 || names[0] != "a.jpg" {
+		t.Errorf("List returned %v, want [a.jpg]", names)
+	}
+	if _, err := os.Stat(path.Join(dir, ".a.jpg.tmp")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("List kept the temporary file: %v", err)
+	}
+	if _, err := store.Stat("sub"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a directory returned %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, &Memory{})
+}
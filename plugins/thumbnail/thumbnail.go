@@ -4,26 +4,27 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"image"
 	"io"
-	"io/ioutil"
 	"log"
-	"mime"
 	"net/http"
-	"os"
-	"path"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/clementd64/tachiql/pkg/backup"
 	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/clementd64/tachiql/plugins/server"
 	"github.com/graphql-go/graphql"
 )
 
 type ID struct {
-	Source int64
-	Url    string
+	Source int64  `json:"source"`
+	Url    string `json:"url"`
 }
 
 func mangaId(manga *backup.Manga) ID {
@@ -33,48 +34,121 @@ func mangaId(manga *backup.Manga) ID {
 	}
 }
 
+type Downloaded struct {
+	ID       ID
+	Filename string
+	Size     int
+}
+
+type Failed struct {
+	ID  ID
+	Err error
+}
+
+type StatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "failed to fetch image " + e.Url + ": " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+}
+
+// StoreError is an error of the thumbnail store or index. Unlike the failure
+// of a single thumbnail, it aborts the backup reload.
+type StoreError struct {
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return "thumbnail store: " + e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode >= 500 || status.StatusCode == http.StatusTooManyRequests
+	}
+	var invalid *InvalidError
+	if errors.As(err, &invalid) {
+		return invalid.Temporary
+	}
+	return true
+}
+
 type Config struct {
-	Path     string
-	Prefix   string
-	Download func(*backup.Manga) ([]byte, string, error)
-	GetReq   func(*backup.Manga) (*http.Request, error)
+	// Path is the directory the thumbnails are stored in when Store is nil
+	Path   string
+	Store  Store
+	Prefix string
+	Server *server.Server
+	Mount  string
+	// Authenticate requires the server authentication to get the thumbnails.
+	// They are public by default, as browsers send no bearer token with images.
+	Authenticate bool
+	Download     func(*backup.Manga) ([]byte, string, error)
+	GetReq       func(*backup.Manga) (*http.Request, error)
+	// Rules customize the requests sent by GetReq per source
+	Rules    []Rule
 	Filename func(manga *backup.Manga) string
+	// Index is the file the cache index is persisted to, the directory is
+	// scanned on startup when empty
+	Index string
+
+	Concurrency  int
+	HostInterval time.Duration
+	Timeout      time.Duration
+	// MaxSize is the largest thumbnail accepted in bytes, 10 MiB by default
+	MaxSize      int64
+	Retries      int
+	RetryBackoff time.Duration
+	// RefreshInterval is how often the thumbnails are revalidated, 24 hours by
+	// default, a negative interval disables the refresh
+	RefreshInterval time.Duration
+	// CoverCache is a copy of the Tachiyomi cover cache, LocalSource the
+	// directory of the local source. Covers found there are not downloaded.
+	CoverCache  string
+	LocalSource string
+	// DefaultCover is the URL returned for the mangas without thumbnail,
+	// Placeholder generates a cover with their initials instead
+	DefaultCover string
+	Placeholder  bool
+	// Async lets the backup reload complete before the thumbnails are downloaded
+	Async bool
+	// GC collects the orphaned thumbnails after each reload
+	GC *GC
+	// Variants are the maximum widths of the resized thumbnails,
+	// DefaultVariants when nil, an empty map disables them
+	Variants map[Size]int
+	// Format is the encoding of the resized thumbnails, jpeg (default) or png
+	Format string
+	// Quality is the jpeg quality of the resized thumbnails
+	Quality int
 }
 
 type Thumbnail struct {
 	config      Config
+	mu          sync.RWMutex
 	files       map[ID]string
 	rollupFiles map[ID]string
+	failures    map[ID]error
+	events      *graph.Bus
+	hosts       *hostLimiter
+	client      *http.Client
+	rules       ruleSet
+	index       *index
+	pending     chan []*backup.Manga
+	// reload serializes Root and the garbage collection, loading holds the
+	// mangas of the last backup given to Root
+	reload  sync.Mutex
+	loading []*backup.Manga
 }
 
 func New(config Config) *Thumbnail {
-	if config.Download == nil {
-		config.Download = func(manga *backup.Manga) ([]byte, string, error) {
-			req, err := config.GetReq(manga)
-			if err != nil {
-				return nil, "", err
-			}
-
-			client := &http.Client{}
-			res, err := client.Do(req)
-			if err != nil {
-				return nil, "", err
-			}
-			defer res.Body.Close()
-
-			if res.StatusCode >= 300 {
-				return nil, "", errors.New("failed to fetch image " + manga.GetThumbnailUrl())
-			}
-
-			body, err := io.ReadAll(res.Body)
-			if err != nil {
-				return nil, "", err
-			}
-
-			return body, res.Header.Get("Content-Type"), nil
-		}
-	}
-
 	if config.GetReq == nil {
 		config.GetReq = func(manga *backup.Manga) (*http.Request, error) {
 			return http.NewRequest("GET", manga.GetThumbnailUrl(), nil)
@@ -88,74 +162,479 @@ func New(config Config) *Thumbnail {
 		}
 	}
 
-	return &Thumbnail{
-		config: config,
-		files:  make(map[ID]string),
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+
+	if config.Store == nil {
+		config.Store = Dir(config.Path)
+	}
+
+	if config.MaxSize <= 0 {
+		config.MaxSize = 10 << 20
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = time.Second
+	}
+
+	if config.Format == "" {
+		config.Format = "jpeg"
+	}
+
+	if config.Variants == nil {
+		config.Variants = DefaultVariants
+	}
+
+	if config.Quality == 0 {
+		config.Quality = 85
+	}
+
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = 24 * time.Hour
+	}
+
+	if config.Mount == "" {
+		config.Mount = "/thumbnails/"
+	}
+
+	if !strings.HasSuffix(config.Mount, "/") {
+		config.Mount += "/"
+	}
+
+	if config.Server != nil && config.Prefix == "" {
+		config.Prefix = config.Mount
+	}
+
+	t := &Thumbnail{
+		config:  config,
+		files:   make(map[ID]string),
+		hosts:   &hostLimiter{interval: config.HostInterval},
+		client:  &http.Client{Timeout: config.Timeout},
+		index:   &index{store: config.Store, file: config.Index},
+		pending: make(chan []*backup.Manga, 1),
 	}
+	t.rules.compile(config)
+	return t
 }
 
 func (t *Thumbnail) DownloadThumbnail(manga *backup.Manga) (string, error) {
-	if manga.ThumbnailUrl == nil {
+	return t.download(context.Background(), manga, false)
+}
+
+// Cached returns the cache entry of the thumbnail of a manga.
+func (t *Thumbnail) Cached(id ID) (Entry, bool) {
+	return t.index.get(id)
+}
+
+func (t *Thumbnail) cached(manga *backup.Manga) (Entry, bool, error) {
+	if err := t.index.load(); err != nil {
+		return Entry{}, false, err
+	}
+
+	entry, ok := t.index.lookup(mangaId(manga), t.config.Filename(manga), manga.GetThumbnailUrl())
+	return entry, ok, nil
+}
+
+func (t *Thumbnail) download(ctx context.Context, manga *backup.Manga, revalidate bool) (string, error) {
+	filename, err := t.update(ctx, manga, revalidate)
+	if ctx.Err() == nil && t.hasThumbnail(manga) {
+		t.setFailure(mangaId(manga), err)
+	}
+	return filename, err
+}
+
+// update fetches the thumbnail when it is not cached or its URL changed, and
+// revalidates the cached one when revalidate is set. The cached thumbnail is
+// still returned along with the error when it can not be refreshed.
+func (t *Thumbnail) update(ctx context.Context, manga *backup.Manga, revalidate bool) (string, error) {
+	if !t.hasThumbnail(manga) {
 		return "", nil
 	}
 
-	filename := t.config.Filename(manga)
+	cached, ok, err := t.cached(manga)
+	if err != nil {
+		return "", &StoreError{err}
+	}
 
-	dir, err := os.ReadDir(t.config.Path)
+	var previous *Entry
+	if ok {
+		if cached.Url == manga.GetThumbnailUrl() && !revalidate {
+			return cached.Filename, nil
+		}
+		previous = &cached
+	}
+
+	res, found := t.local(manga, previous)
+	if !found && manga.ThumbnailUrl == nil {
+		return cached.Filename, nil
+	}
+	if !found {
+		// fetch validates the thumbnail to retry temporary failures
+		res, err = t.fetch(ctx, manga, previous)
+	} else if !res.notModified {
+		err = t.validate(manga.GetThumbnailUrl(), res)
+	}
 	if err != nil {
-		return "", err
+		t.publish(Failed{ID: mangaId(manga), Err: err})
+		return cached.Filename, err
+	}
+
+	if res.notModified {
+		if res.etag != "" || res.lastModified != "" {
+			cached.ETag, cached.LastModified = res.etag, res.lastModified
+			t.index.add(cached)
+		}
+		return cached.Filename, nil
+	}
+
+	hash := contentHash(res.body)
+	if previous != nil && t.hash(*previous) == hash {
+		// servers without validators send the same bytes again, the
+		// thumbnail keeps its revision and variants
+		cached.Url, cached.ETag, cached.LastModified, cached.Hash = manga.GetThumbnailUrl(), res.etag, res.lastModified, hash
+		t.index.add(cached)
+		return cached.Filename, nil
+	}
+
+	filename := t.config.Filename(manga) + res.ext
+
+	if err := t.config.Store.Put(filename, res.body); err != nil {
+		err = &StoreError{err}
+		t.publish(Failed{ID: mangaId(manga), Err: err})
+		return cached.Filename, err
+	}
+
+	entry := Entry{
+		ID:           mangaId(manga),
+		Filename:     filename,
+		Size:         int64(len(res.body)),
+		ModTime:      time.Now(),
+		ContentType:  res.contentType,
+		Url:          manga.GetThumbnailUrl(),
+		ETag:         res.etag,
+		LastModified: res.lastModified,
+		Hash:         hash,
 	}
-	for _, file := range dir {
-		if strings.TrimSuffix(file.Name(), path.Ext(file.Name())) == filename {
-			return file.Name(), nil
+	if previous != nil {
+		entry.Revision = previous.Revision + 1
+		if previous.Filename != filename {
+			t.config.Store.Delete(previous.Filename)
 		}
 	}
+	t.index.add(entry)
+	t.decode(entry, res.img)
+
+	t.publish(Downloaded{ID: mangaId(manga), Filename: filename, Size: len(res.body)})
+	return filename, nil
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// hash returns the hash of a cached thumbnail, reading the ones indexed before
+// hashes were recorded.
+func (t *Thumbnail) hash(entry Entry) string {
+	if entry.Hash != "" {
+		return entry.Hash
+	}
 
-	thumbnail, mimetype, err := t.config.Download(manga)
+	file, err := t.config.Store.Get(entry.Filename)
 	if err != nil {
-		return "", err
+		return ""
 	}
+	defer file.Close()
 
-	exts, err := mime.ExtensionsByType(mimetype)
+	content, err := io.ReadAll(file)
 	if err != nil {
-		return "", err
+		return ""
 	}
+	return contentHash(content)
+}
+
+type response struct {
+	body         []byte
+	img          image.Image
+	contentType  string
+	ext          string
+	etag         string
+	lastModified string
+	notModified  bool
+}
 
-	ext := ".bin"
-	if exts != nil {
-		ext = exts[len(exts)-1]
+func (t *Thumbnail) fetch(ctx context.Context, manga *backup.Manga, cached *Entry) (*response, error) {
+	backoff := t.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		res, err := t.request(ctx, manga, cached)
+		if err == nil && !res.notModified {
+			err = t.validate(manga.GetThumbnailUrl(), res)
+		}
+		if err == nil || attempt >= t.config.Retries || !retryable(err) {
+			return res, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
+}
+
+// request downloads the thumbnail, conditionally when the cached one comes
+// from the same URL. It waits for the host the request is sent to, once the
+// rules rewrote it.
+func (t *Thumbnail) request(ctx context.Context, manga *backup.Manga, cached *Entry) (*response, error) {
+	if t.config.Download != nil {
+		u, err := url.Parse(manga.GetThumbnailUrl())
+		if err != nil {
+			return nil, err
+		}
+		if err := t.hosts.wait(ctx, u.Host); err != nil {
+			return nil, err
+		}
 
-	err = ioutil.WriteFile(path.Join(t.config.Path, filename+ext), thumbnail, 0644)
+		body, _, err := t.config.Download(manga)
+		return &response{body: body}, err
+	}
+
+	if t.rules.err != nil {
+		return nil, t.rules.err
+	}
+
+	req, err := t.config.GetReq(manga)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	return filename + ext, nil
+	client, err := t.rules.apply(req, manga, t.client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.hosts.wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+
+	if cached != nil && cached.Url == manga.GetThumbnailUrl() {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match")+req.Header.Get("If-Modified-Since") != "" {
+		return &response{
+			etag:         res.Header.Get("ETag"),
+			lastModified: res.Header.Get("Last-Modified"),
+			notModified:  true,
+		}, nil
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, &StatusError{manga.GetThumbnailUrl(), res.StatusCode}
+	}
+
+	if res.ContentLength > t.config.MaxSize {
+		return nil, &InvalidError{Url: manga.GetThumbnailUrl(), Reason: "larger than " + strconv.FormatInt(t.config.MaxSize, 10) + " bytes"}
+	}
+
+	// read one more byte so validate notices oversized bodies
+	body, err := io.ReadAll(io.LimitReader(res.Body, t.config.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{
+		body:         body,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+func (t *Thumbnail) publish(event graph.Event) {
+	if t.events != nil {
+		t.events.Publish(event)
+	}
 }
 
 func (t *Thumbnail) DownloadThumbnails(mangas []*backup.Manga, returnError bool) (map[ID]string, error) {
+	return t.downloadAll(context.Background(), mangas, returnError, false, nil)
+}
+
+// downloadAll downloads the thumbnails using Concurrency workers, calling
+// done as soon as each one is available. When returnError is set, the first
+// StoreError cancels the remaining downloads and is returned.
+func (t *Thumbnail) downloadAll(ctx context.Context, mangas []*backup.Manga, returnError bool, revalidate bool, done func(ID, string)) (map[ID]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *backup.Manga)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
 	files := map[ID]string{}
-	for _, manga := range mangas {
-		filename, err := t.DownloadThumbnail(manga)
-		if err != nil {
-			if returnError {
-				return nil, err
+	var firstErr error
+
+	for i := 0; i < t.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for manga := range jobs {
+				filename, err := t.download(ctx, manga, revalidate)
+				// a thumbnail failing to download is recorded as failed and
+				// keeps its cached file, only the store errors are returned
+				var storeErr *StoreError
+				if err != nil && returnError && errors.As(err, &storeErr) {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				} else if err != nil {
+					log.Print(err)
+				}
+
+				if filename == "" {
+					continue
+				}
+
+				mu.Lock()
+				files[mangaId(manga)] = filename
+				mu.Unlock()
+				if done != nil {
+					done(mangaId(manga), filename)
+				}
 			}
-			log.Print(err)
-		} else {
-			files[mangaId(manga)] = filename
+		}()
+	}
+
+feed:
+	for _, manga := range mangas {
+		select {
+		case jobs <- manga:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(jobs)
+	wg.Wait()
+
+	if err := t.index.save(); err != nil {
+		log.Print(err)
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
 	return files, nil
 }
 
+func (t *Thumbnail) file(id ID) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	file, ok := t.files[id]
+	return file, ok
+}
+
+func (t *Thumbnail) setFile(id ID, file string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[id] = file
+}
+
+func (t *Thumbnail) setFiles(files map[ID]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files = files
+}
+
 func (t *Thumbnail) Schema(g *graph.Graph) error {
+	if t.config.Format != "jpeg" && t.config.Format != "png" {
+		return errors.New("thumbnail: unknown format " + t.config.Format)
+	}
+
+	if t.rules.err != nil {
+		return t.rules.err
+	}
+
+	t.events = g.Events
+
+	if t.config.Server != nil {
+		if t.config.Authenticate {
+			t.config.Server.Handle(t.config.Mount, t)
+		} else {
+			t.config.Server.HandlePublic(t.config.Mount, t)
+		}
+	}
+
+	coverType := t.coverType()
+	for _, typ := range []graphql.Type{coverType, statusEnum} {
+		if err := g.Schema.AppendType(typ); err != nil {
+			return err
+		}
+	}
+
+	g.Types["Manga"].Fields()["cover"] = &graphql.FieldDefinition{
+		Name: "cover",
+		Type: coverType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if c, ok := t.cover(p.Source.(*backup.Manga)); ok {
+				return c, nil
+			}
+			return nil, nil
+		},
+	}
+
 	g.Types["Manga"].Fields()["thumbnail"] = &graphql.FieldDefinition{
+		Name: "thumbnail",
 		Type: graphql.String,
+		Args: []*graphql.Argument{{
+			PrivateName:  "size",
+			Type:         sizeEnum,
+			DefaultValue: Original,
+		}},
+		DeprecationReason: "Use cover { url }",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			if url, ok := t.files[mangaId(p.Source.(*backup.Manga))]; ok {
-				return t.config.Prefix + url, nil
+			if c, ok := t.cover(p.Source.(*backup.Manga)); ok {
+				return t.url(c, p.Args["size"].(Size)), nil
+			}
+			return nil, nil
+		},
+	}
+
+	g.Types["Manga"].Fields()["thumbnailStatus"] = &graphql.FieldDefinition{
+		Name: "thumbnailStatus",
+		Type: graphql.NewNonNull(statusEnum),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			status, _ := t.status(p.Source.(*backup.Manga))
+			return status, nil
+		},
+	}
+
+	g.Types["Manga"].Fields()["thumbnailError"] = &graphql.FieldDefinition{
+		Name: "thumbnailError",
+		Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if _, err := t.status(p.Source.(*backup.Manga)); err != nil {
+				return err.Error(), nil
 			}
 			return nil, nil
 		},
@@ -165,28 +644,117 @@ func (t *Thumbnail) Schema(g *graph.Graph) error {
 }
 
 func (t *Thumbnail) Root(_ *graph.Graph, b interface{}) error {
-	files, err := t.DownloadThumbnails(b.(*backup.Backup).Mangas, true)
-	if err != nil {
-		return err
+	mangas := b.(*backup.Backup).Mangas
+	t.rules.setSources(b.(*backup.Backup).Sources)
+
+	t.reload.Lock()
+	defer t.reload.Unlock()
+	t.loading = mangas
+
+	if !t.config.Async {
+		files, err := t.DownloadThumbnails(mangas, true)
+		if err != nil {
+			return err
+		}
+		t.rollupFiles = files
+		t.queue(mangas)
+		return nil
+	}
+
+	files := map[ID]string{}
+	for _, manga := range mangas {
+		if !t.hasThumbnail(manga) {
+			continue
+		}
+		if entry, ok, err := t.cached(manga); err != nil {
+			return err
+		} else if ok {
+			files[mangaId(manga)] = entry.Filename
+		}
 	}
 	t.rollupFiles = files
+
+	if err := t.index.save(); err != nil {
+		log.Print(err)
+	}
+
+	t.queue(mangas)
 	return nil
 }
 
+// queue hands the mangas over to the worker, only the latest backup is worth
+// processing.
+func (t *Thumbnail) queue(mangas []*backup.Manga) {
+	select {
+	case <-t.pending:
+	default:
+	}
+	t.pending <- mangas
+}
+
 func (t *Thumbnail) Clean() {
 	if t.rollupFiles != nil {
-		t.files = t.rollupFiles
+		t.setFiles(t.rollupFiles)
 	}
 	t.rollupFiles = nil
 }
 
+// collect runs the garbage collection, keeping the thumbnails of both the
+// current root and the backups being loaded. It waits for Root to complete,
+// so the thumbnails it writes are never collected.
+func (t *Thumbnail) collect(ctx context.Context, g *graph.Graph, mangas []*backup.Manga) {
+	if t.config.GC == nil || ctx.Err() != nil {
+		return
+	}
+
+	t.reload.Lock()
+	defer t.reload.Unlock()
+
+	mangas = append(mangas[:len(mangas):len(mangas)], t.loading...)
+	if b, ok := g.Root.(*backup.Backup); ok {
+		mangas = append(mangas, b.Mangas...)
+	}
+
+	report, err := t.CollectGarbage(mangas, *t.config.GC)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if t.config.GC.DryRun && len(report.Orphans) > 0 {
+		log.Printf("thumbnail gc: %d orphaned thumbnails (%d bytes) would be collected", len(report.Orphans), report.Size)
+	}
+}
+
 func (t *Thumbnail) Worker(ctx context.Context, g *graph.Graph) error {
+	var refresh <-chan time.Time
+	if t.config.RefreshInterval > 0 {
+		ticker := time.NewTicker(t.config.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.After(24 * time.Hour):
-			t.files, _ = t.DownloadThumbnails(g.Root.(*backup.Backup).Mangas, false)
+		case mangas := <-t.pending:
+			if t.config.Async {
+				t.downloadAll(ctx, mangas, false, false, t.setFile)
+			}
+			if t.decodeAll(ctx, mangas) || t.config.Async {
+				g.Invalidate()
+			}
+			t.collect(ctx, g, mangas)
+		case <-refresh:
+			if b, ok := g.Root.(*backup.Backup); ok {
+				files, _ := t.downloadAll(ctx, b.Mangas, false, true, nil)
+				if ctx.Err() != nil {
+					return nil
+				}
+				t.setFiles(files)
+				t.decodeAll(ctx, b.Mangas)
+				g.Invalidate()
+			}
 		}
 	}
 }
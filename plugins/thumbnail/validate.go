@@ -0,0 +1,52 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// InvalidError marks the manga as failed without affecting the other
+// thumbnails.
+type InvalidError struct {
+	Url    string
+	Reason string
+	// Temporary is set when the server answered with a page instead of an
+	// image, such as an error or a challenge page, which is worth retrying
+	Temporary bool
+}
+
+func (e *InvalidError) Error() string {
+	return "invalid thumbnail " + e.Url + ": " + e.Reason
+}
+
+// validate decodes the downloaded bytes to check they are a complete image,
+// and sets the content type and extension of the response regardless of what
+// the server announced. The decoded image is kept to generate the metadata.
+func (t *Thumbnail) validate(url string, res *response) error {
+	if int64(len(res.body)) > t.config.MaxSize {
+		return &InvalidError{Url: url, Reason: "larger than " + strconv.FormatInt(t.config.MaxSize, 10) + " bytes"}
+	}
+
+	if sniffed := http.DetectContentType(res.body); !strings.HasPrefix(sniffed, "image/") {
+		return &InvalidError{Url: url, Reason: "not an image (" + sniffed + ")", Temporary: true}
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(res.body))
+	if err != nil {
+		return &InvalidError{Url: url, Reason: err.Error()}
+	}
+	if img.Bounds().Empty() {
+		return &InvalidError{Url: url, Reason: "empty image"}
+	}
+
+	res.img = img
+	res.contentType = "image/" + format
+	res.ext = "." + format
+	if format == "jpeg" {
+		res.ext = ".jpg"
+	}
+	return nil
+}
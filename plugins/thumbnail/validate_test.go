@@ -0,0 +1,93 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clementd64/tachiql/pkg/backup"
+	"google.golang.org/protobuf/proto"
+)
+
+// testImage returns a PNG noisy enough not to fit in its first bytes.
+func testImage(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 96))
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 37), uint8(y * 53), uint8(x * y), 255})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadValidates(t *testing.T) {
+	cover := testImage(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/truncated.png":
+			w.Write(cover[:len(cover)/3])
+		case "/page.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("<!DOCTYPE html><html><body>Just a moment...</body></html>"))
+		default:
+			w.Write(cover)
+		}
+	}))
+	defer srv.Close()
+
+	manga := func(path string) *backup.Manga {
+		return &backup.Manga{
+			Source:       proto.Int64(1),
+			Url:          proto.String(path),
+			ThumbnailUrl: proto.String(srv.URL + path),
+		}
+	}
+
+	for _, path := range []string{"/truncated.png", "/page.png"} {
+		store := &Memory{}
+		th := New(Config{Store: store})
+
+		filename, err := th.DownloadThumbnail(manga(path))
+		var invalid *InvalidError
+		if !errors.As(err, &invalid) {
+			t.Errorf("%s: DownloadThumbnail returned %q, %v, want an InvalidError", path, filename, err)
+		}
+		if files, _ := store.List(); len(files) != 0 {
+			t.Errorf("%s: the invalid thumbnail was stored: %v", path, files)
+		}
+	}
+
+	store := &Memory{}
+	th := New(Config{Store: store, Variants: map[Size]int{Small: 32}})
+	m := manga("/cover")
+	filename, err := th.DownloadThumbnail(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != th.config.Filename(m)+".png" {
+		t.Errorf("DownloadThumbnail returned %q, want the png extension", filename)
+	}
+
+	entry, ok := th.Cached(mangaId(m))
+	if !ok {
+		t.Fatal("the thumbnail is not indexed")
+	}
+	if entry.ContentType != "image/png" || entry.Width != 64 || entry.Height != 96 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if _, err := store.Stat(entry.Variants[Small]); err != nil {
+		t.Errorf("the small variant was not generated: %v", err)
+	}
+}
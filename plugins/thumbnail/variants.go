@@ -0,0 +1,80 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/graphql-go/graphql"
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Size string
+
+const (
+	Small    Size = "small"
+	Medium   Size = "medium"
+	Original Size = "original"
+)
+
+// DefaultVariants are the maximum widths of the resized thumbnails.
+var DefaultVariants = map[Size]int{
+	Small:  160,
+	Medium: 480,
+}
+
+var sizeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ThumbnailSize",
+	Values: graphql.EnumValueConfigMap{
+		"SMALL":    &graphql.EnumValueConfig{Value: Small},
+		"MEDIUM":   &graphql.EnumValueConfig{Value: Medium},
+		"ORIGINAL": &graphql.EnumValueConfig{Value: Original},
+	},
+})
+
+func (t *Thumbnail) variantName(filename string, size Size) string {
+	ext := ".jpg"
+	if t.config.Format == "png" {
+		ext = ".png"
+	}
+	return stem(filename) + "." + string(size) + ext
+}
+
+// scale resizes the image to width, keeping its aspect ratio. Images are never
+// enlarged.
+func scale(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width <= 0 || bounds.Dx() <= width {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height == 0 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+func (t *Thumbnail) encode(img image.Image) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if t.config.Format == "png" {
+		err := png.Encode(buf, img)
+		return buf.Bytes(), err
+	}
+
+	// jpeg has no transparency, flatten the image on white
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	err := jpeg.Encode(buf, flat, &jpeg.Options{Quality: t.config.Quality})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/clementd64/tachiql/pkg/graph"
+	"github.com/graphql-go/graphql"
+)
+
+// ReloadError describes a failed reload of the backup.
+type ReloadError struct {
+	Filename string
+	Err      error
+	At       time.Time
+	// Corrupted is set when the backup could not be decoded
+	Corrupted bool
+}
+
+func (e *ReloadError) Error() string {
+	return "failed to load backup " + e.Filename + ": " + e.Err.Error()
+}
+
+func (e *ReloadError) Unwrap() error {
+	return e.Err
+}
+
+// LastError returns the last failed reload, or nil when the last reload
+// succeeded.
+func (w *Watch) LastError() *ReloadError {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.lastError
+}
+
+func (w *Watch) record(filename string, err error, corrupted bool) *ReloadError {
+	e := &ReloadError{Filename: filename, Err: err, At: time.Now(), Corrupted: corrupted}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastError = e
+	return e
+}
+
+// fail records a reload that failed before reaching SetRoot.
+func (w *Watch) fail(g *graph.Graph, filename string, err error, corrupted bool) *ReloadError {
+	e := w.record(filename, err, corrupted)
+	g.Events.Publish(graph.RootFailed{Source: filename, Err: e})
+	return e
+}
+
+// retry reports whether the backup should be reloaded after a failure. A
+// backup that can not be decoded may still be synced, so it is read again
+// until Attempts is reached, then quarantined when enabled so the previous
+// backup gets loaded.
+func (w *Watch) retry(err error) bool {
+	var e *ReloadError
+	if !errors.As(err, &e) || !e.Corrupted {
+		return false
+	}
+
+	attempts := w.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	w.mu.Lock()
+	if w.failures == nil {
+		w.failures = map[string]int{}
+	}
+	w.failures[e.Filename]++
+	failures := w.failures[e.Filename]
+	if failures >= attempts {
+		delete(w.failures, e.Filename)
+	}
+	w.mu.Unlock()
+
+	if failures < attempts {
+		return true
+	}
+	if !w.Quarantine {
+		return false
+	}
+
+	if err := os.Rename(e.Filename, e.Filename+".corrupted"); err != nil {
+		log.Print(err)
+		return false
+	}
+	log.Print("quarantined corrupted backup ", e.Filename)
+	return true
+}
+
+func (w *Watch) Schema(g *graph.Graph) error {
+	reloadErrorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ReloadError",
+		Fields: graphql.Fields{
+			"filename": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*ReloadError).Filename, nil
+				},
+			},
+			"error": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*ReloadError).Err.Error(), nil
+				},
+			},
+			"at": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*ReloadError).At, nil
+				},
+			},
+		},
+	})
+
+	metaType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Meta",
+		Fields: graphql.Fields{
+			"currentBackup": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if g.Root == nil || g.RootInfo.Source == "" {
+						return nil, nil
+					}
+					return g.RootInfo.Source, nil
+				},
+			},
+			"loadedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if g.Root == nil {
+						return nil, nil
+					}
+					return g.RootInfo.LoadedAt, nil
+				},
+			},
+			"lastReloadError": &graphql.Field{
+				Type: reloadErrorType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if e := w.LastError(); e != nil {
+						return e, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	for _, typ := range []graphql.Type{reloadErrorType, metaType} {
+		if err := g.Schema.AppendType(typ); err != nil {
+			return err
+		}
+	}
+
+	g.Schema.QueryType().Fields()["meta"] = &graphql.FieldDefinition{
+		Name: "meta",
+		Type: graphql.NewNonNull(metaType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return w, nil
+		},
+	}
+	return nil
+}
@@ -3,6 +3,11 @@ package watch
 import (
 	"context"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/clementd64/tachiql/pkg/backup"
 	"github.com/clementd64/tachiql/pkg/graph"
@@ -11,39 +16,226 @@ import (
 
 type Watch struct {
 	Dir string
+	// Quiet is how long the directory must stay unchanged before the backup is
+	// reloaded, 2 seconds by default
+	Quiet time.Duration
+	// Poll is the interval the directory is scanned at instead of using
+	// fsnotify, which does not work on network filesystems. Polling is used
+	// every 10 seconds when fsnotify can not be set up.
+	Poll time.Duration
+	// Attempts is the number of times a backup that can not be decoded is read
+	// before giving up on it, 3 by default. The last good backup is served in
+	// the meantime.
+	Attempts int
+	// Quarantine renames the backups failing every attempt to
+	// <name>.corrupted, so the previous backup is loaded instead
+	Quarantine bool
+
+	mu        sync.RWMutex
+	lastError *ReloadError
+	failures  map[string]int
 }
 
-func (w *Watch) Worker(ctx context.Context, g *graph.Graph) error {
-	watcher, err := fsnotify.NewWatcher()
+// isBackup reports whether the file is a backup, temporary files such as the
+// ones of Syncthing are ignored.
+func isBackup(name string) bool {
+	return strings.HasSuffix(name, ".proto.gz") && !strings.HasPrefix(name, ".")
+}
+
+// relevant reports whether the event may change the latest backup.
+func relevant(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+		return false
+	}
+	return isBackup(filepath.Base(event.Name))
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// scan returns the size and modification time of the backups of the directory.
+func (w *Watch) scan() (map[string]fileState, error) {
+	dir, err := os.ReadDir(w.Dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	files := map[string]fileState{}
+	for _, file := range dir {
+		if !isBackup(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		files[file.Name()] = fileState{info.Size(), info.ModTime()}
+	}
+	return files, nil
+}
+
+func changed(a map[string]fileState, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for name, state := range a {
+		if other, ok := b[name]; !ok || !other.modTime.Equal(state.modTime) || other.size != state.size {
+			return true
+		}
 	}
-	defer watcher.Close()
+	return false
+}
 
-	err = watcher.Add(w.Dir)
+func (w *Watch) notify() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := watcher.Add(w.Dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func (w *Watch) Worker(ctx context.Context, g *graph.Graph) error {
+	quiet := w.Quiet
+	if quiet <= 0 {
+		quiet = 2 * time.Second
+	}
+
+	// nil channels are never selected, so only one of fsnotify and polling is
+	// active
+	var events chan fsnotify.Event
+	var notifyErrors chan error
+	var poll <-chan time.Time
+
+	interval := w.Poll
+	if interval <= 0 {
+		watcher, err := w.notify()
+		if err == nil {
+			defer watcher.Close()
+			events, notifyErrors = watcher.Events, watcher.Errors
+		} else {
+			log.Print("fsnotify: ", err, ", falling back to polling ", w.Dir)
+			interval = 10 * time.Second
+		}
+	}
+
+	var files map[string]fileState
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+		files, _ = w.scan()
 	}
 
+	var reload <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case _, ok := <-watcher.Events:
+		case <-poll:
+			current, err := w.scan()
+			if err != nil {
+				log.Print(err)
+				g.Events.Publish(graph.PluginError{Plugin: graph.PluginName(w), Err: err})
+				continue
+			}
+			if changed(files, current) {
+				files = current
+				reload = time.After(quiet)
+			}
+		case event, ok := <-events:
 			if !ok {
 				continue
 			}
-			b, err := backup.LoadFromDirectory(w.Dir)
-			if err != nil {
-				log.Print(err)
-			} else {
-				g.SetRoot(b)
+			if relevant(event) {
+				// every event restarts the quiet period
+				reload = time.After(quiet)
+			}
+		case <-reload:
+			reload = nil
+			err := w.reload(ctx, g, quiet/4)
+			if err == nil || ctx.Err() != nil {
+				continue
 			}
-		case err, ok := <-watcher.Errors:
+			log.Print(err)
+			g.Events.Publish(graph.PluginError{Plugin: graph.PluginName(w), Err: err})
+			if w.retry(err) {
+				reload = time.After(quiet)
+			}
+		case err, ok := <-notifyErrors:
 			if !ok {
 				continue
 			}
 			log.Print("fsnotify:", err)
+			g.Events.Publish(graph.PluginError{Plugin: graph.PluginName(w), Err: err})
+		}
+	}
+}
+
+// reload loads the latest backup once it is completely written.
+func (w *Watch) reload(ctx context.Context, g *graph.Graph, interval time.Duration) error {
+	filename, err := backup.Latest(w.Dir)
+	if err != nil {
+		return w.fail(g, w.Dir, err, false)
+	}
+
+	if err := waitStable(ctx, filename, interval); err != nil {
+		if ctx.Err() != nil {
+			return err
 		}
+		return w.fail(g, filename, err, false)
 	}
+	return w.load(g, filename)
+}
+
+// waitStable waits until the size of the file stops changing.
+func waitStable(ctx context.Context, filename string, interval time.Duration) error {
+	size := int64(-1)
+	for {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if info.Size() == size {
+			return nil
+		}
+		size = info.Size()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (w *Watch) Load(g *graph.Graph) error {
+	filename, err := backup.Latest(w.Dir)
+	if err != nil {
+		return w.fail(g, w.Dir, err, false)
+	}
+	return w.load(g, filename)
+}
+
+func (w *Watch) load(g *graph.Graph, filename string) error {
+	b, err := backup.LoadBackup(filename)
+	if err != nil {
+		return w.fail(g, filename, err, true)
+	}
+
+	// SetRootFrom publishes RootFailed itself
+	if err := g.SetRootFrom(b, filename); err != nil {
+		return w.record(filename, err, false)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastError = nil
+	delete(w.failures, filename)
+	return nil
 }